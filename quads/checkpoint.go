@@ -0,0 +1,184 @@
+// checkpoint.go
+package quads
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	checkpointMagic   string = "QCKP"
+	checkpointVersion byte   = 1
+)
+
+// WriteCheckpoint writes the tree shape, the queue of quads waiting to be
+// split and the settings that ordered it, so Resume can continue splitting.
+// The layout is:
+//
+//	"QCKP", version, crop flag
+//	uvarint width, uvarint height
+//	uvarint length of metric name, metric name
+//	float64 area exponent, float64 depth penalty, uvarint minimum quad size
+//	uvarint length of split bits, split bits in pre-order
+//	uvarint heap length, heap entries in heap order as pre-order leaf indexes
+func (t *Tree) WriteCheckpoint(w io.Writer) error {
+	if t.in == nil {
+		return errors.New("Error: decoded trees cannot be checkpointed")
+	}
+	head := t.head
+	index := map[*Img]int{}
+	for i, l := range leaves(head, nil) {
+		index[l] = i
+	}
+	splits := encodeSplits(head)
+	metric := strings.ToLower(t.opts.Metric)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(checkpointMagic)
+	c := byte(0)
+	if t.opts.Crop {
+		c = 1
+	}
+	bw.Write([]byte{checkpointVersion, c})
+	writeUvarint(bw, uint64(head.width))
+	writeUvarint(bw, uint64(head.height))
+	writeUvarint(bw, uint64(len(metric)))
+	bw.WriteString(metric)
+	binary.Write(bw, binary.BigEndian, math.Float64bits(t.pr.area))
+	binary.Write(bw, binary.BigEndian, math.Float64bits(t.pr.depth))
+	writeUvarint(bw, uint64(t.pr.min))
+	writeUvarint(bw, uint64(len(splits)))
+	bw.Write(splits)
+	writeUvarint(bw, uint64(t.mh.Len()))
+	for _, i := range t.mh {
+		writeUvarint(bw, uint64(index[i]))
+	}
+	return bw.Flush()
+}
+
+// Resume rebuilds a tree from a checkpoint written by WriteCheckpoint and the
+// source image it was made from. The crop, metric and priority settings stored
+// in the checkpoint replace those in opts, the stop criteria in opts are used.
+func Resume(img image.Image, r io.Reader, opts Options) (*Tree, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, len(checkpointMagic)+2)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr[:len(checkpointMagic)]) != checkpointMagic {
+		return nil, errors.New("Error: not a checkpoint file")
+	}
+	if hdr[len(checkpointMagic)] != checkpointVersion {
+		return nil, fmt.Errorf("Error: unsupported checkpoint version %d", hdr[len(checkpointMagic)])
+	}
+	opts.Crop = hdr[len(checkpointMagic)+1] == 1
+
+	cr := checkpointReader{r: br}
+	w, h := cr.uvarint(), cr.uvarint()
+	opts.Metric = string(cr.bytes(cr.uvarint()))
+	opts.AreaPower, opts.DepthPenalty = cr.float(), cr.float()
+	opts.MinSize = int(cr.uvarint())
+	sn := cr.uvarint()
+	if cr.err != nil {
+		return nil, cr.err
+	}
+
+	t, err := New(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	head := t.head
+	if uint64(head.width) != w || uint64(head.height) != h {
+		return nil, fmt.Errorf("Error: checkpoint size %dx%d does not match image size %dx%d", w, h, head.width, head.height)
+	}
+	//A tree of 1px leaves has the most quads, a third more than its pixels
+	if most := (4*w*h/3 + 8) / 8; sn > most {
+		return nil, fmt.Errorf("Error: %d bytes of split bits, more than a %dx%d tree has", sn, w, h)
+	}
+	splits := cr.bytes(sn)
+	if cr.err != nil {
+		return nil, cr.err
+	}
+	if err := decodeSplits(head, splits); err != nil {
+		return nil, err
+	}
+	analyzeTree(t.in, t.metric, head)
+
+	ls := leaves(head, nil)
+	n := cr.uvarint()
+	if n > uint64(len(ls)) {
+		return nil, errors.New("Error: checkpoint heap larger than quad tree")
+	}
+	mh, queued := make(minHeap, n), make([]bool, len(ls))
+	for i := range mh {
+		l := cr.uvarint()
+		if cr.err != nil {
+			return nil, cr.err
+		}
+		switch {
+		case l >= uint64(len(ls)):
+			return nil, errors.New("Error: checkpoint heap entry outside quad tree")
+		case queued[l]:
+			return nil, fmt.Errorf("Error: checkpoint heap lists quad %d twice", l)
+		case !t.pr.splittable(ls[l]):
+			return nil, fmt.Errorf("Error: checkpoint heap lists quad %d, which is too small to split", l)
+		}
+		queued[l] = true
+		mh[i] = ls[l]
+		mh[i].priority = t.pr.score(mh[i])
+	}
+	heap.Init(&mh)
+	t.mh = mh
+	t.pg = newProgress(t.in, head)
+	return t, nil
+}
+
+// Computes color and error of every quad below head
+func analyzeTree(in *integral, m errorMetric, head *Img) {
+	if head.c1 == nil {
+		return
+	}
+	for _, c := range []*Img{head.c1, head.c2, head.c3, head.c4} {
+		c.color, c.error = analyzeImage(in, m, c)
+		analyzeTree(in, m, c)
+	}
+}
+
+type checkpointReader struct {
+	r   *bufio.Reader
+	err error //First error encountered
+}
+
+func (cr *checkpointReader) uvarint() uint64 {
+	if cr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(cr.r)
+	cr.err = err
+	return v
+}
+
+func (cr *checkpointReader) float() float64 {
+	if cr.err != nil {
+		return 0
+	}
+	var v uint64
+	cr.err = binary.Read(cr.r, binary.BigEndian, &v)
+	return math.Float64frombits(v)
+}
+
+func (cr *checkpointReader) bytes(n uint64) []byte {
+	if cr.err != nil {
+		return nil
+	}
+	var b []byte
+	b, cr.err = readBytes(cr.r, n)
+	return b
+}
@@ -0,0 +1,90 @@
+package quads
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Iterations = 150
+	img := testImage(97, 61)
+	whole, err := New(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := whole.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Iterations = 60
+	part, err := New(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := part.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := part.WriteCheckpoint(&buf); err != nil {
+		t.Fatal(err)
+	}
+	opts.Iterations = 150
+	tr, err := Resume(img, &buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(encodeSplits(tr.head), encodeSplits(whole.head)) {
+		t.Error("resumed tree differs from one run without a checkpoint")
+	}
+}
+
+// Checkpoint of a 40x30 image split once, with the given minimum quad size,
+// split bits length and heap entries
+func testCheckpoint(min uint64, splitLen uint64, heap ...uint64) []byte {
+	var b bytes.Buffer
+	b.WriteString(checkpointMagic)
+	b.Write([]byte{checkpointVersion, 0})
+	for _, v := range []uint64{40, 30, 3} {
+		writeUvarint(&b, v)
+	}
+	b.WriteString("mse")
+	binary.Write(&b, binary.BigEndian, math.Float64bits(1))
+	binary.Write(&b, binary.BigEndian, math.Float64bits(1))
+	writeUvarint(&b, min)
+	writeUvarint(&b, splitLen)
+	//The root split into four leaves
+	b.WriteByte(0x80)
+	writeUvarint(&b, uint64(len(heap)))
+	for _, l := range heap {
+		writeUvarint(&b, l)
+	}
+	return b.Bytes()
+}
+
+func TestResumeCorrupt(t *testing.T) {
+	img := testImage(40, 30)
+	if _, err := Resume(img, bytes.NewReader(testCheckpoint(1, 1, 0, 1, 2, 3)), DefaultOptions()); err != nil {
+		t.Fatalf("valid checkpoint: %v", err)
+	}
+	for name, b := range map[string][]byte{
+		"huge split bits":  testCheckpoint(1, 1<<40, 0),
+		"truncated":        testCheckpoint(1, 1, 0, 1, 2, 3)[:30],
+		"heap outside":     testCheckpoint(1, 1, 0, 4),
+		"heap duplicate":   testCheckpoint(1, 1, 0, 1, 0),
+		"heap too small":   testCheckpoint(16, 1, 2),
+		"heap too long":    testCheckpoint(1, 1, 0, 1, 2, 3, 0),
+		"split bits short": testCheckpoint(1, 1<<20, 0)[:40],
+	} {
+		if _, err := Resume(img, bytes.NewReader(b), DefaultOptions()); err == nil {
+			t.Errorf("%s: resumed a corrupt checkpoint", name)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// batch.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradymadden97/go-quads/quads"
+)
+
+// Input image extensions picked up from batch folders
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".tif": true, ".tiff": true, ".bmp": true}
+
+type batchJob struct {
+	in  string //Input image path
+	rel string //Path of the input below its folder or glob, mirrored under -o
+}
+
+type batchResult struct {
+	done    bool //Outputs written
+	skipped bool //Outputs up to date
+	err     error
+}
+
+// Runs quads on every image below the folders and glob patterns in args,
+// mirroring their layout under the -o folder
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags := newFlags(fs)
+	j := fs.Int("j", runtime.NumCPU(), "Number of images to process at once")
+	force := fs.Bool("force", false, "Process images even when their outputs are newer than the input")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: quads batch [flags] folder|glob ...")
+		fs.PrintDefaults()
+	}
+	ins, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(ins) == 0 {
+		fs.Usage()
+		return fmt.Errorf("Error: batch needs at least one folder or glob")
+	}
+	if *flags.o == stdio || isFile(*flags.o) {
+		return fmt.Errorf("Error: batch output %q is not a folder", *flags.o)
+	}
+	if *flags.f != "" || *flags.d != "" || *flags.r != "" {
+		return fmt.Errorf("Error: -f, -d and -resume are not supported in batch")
+	}
+	if *j < 1 {
+		return fmt.Errorf("Error: batch jobs %d less than 1", *j)
+	}
+	//Progress lines and terminal images of concurrent images would overwrite
+	//each other
+	*flags.p, *flags.tm, *flags.lv = false, false, false
+
+	ro, err := renderOptions(flags)
+	if err != nil {
+		return err
+	}
+	opts, err := treeOptions(flags)
+	if err != nil {
+		return err
+	}
+	jobs, err := batchJobs(ins)
+	if err != nil {
+		return err
+	}
+
+	//An interrupt stops starting images, the ones started still finish so no
+	//partial outputs look up to date to the next batch
+	ctx, stop := interruptContext()
+	defer stop()
+	start := time.Now()
+	results := make([]batchResult, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *j; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				results[k] = runJob(flags, opts, ro, jobs[k], *force)
+			}
+		}()
+	}
+dispatch:
+	for k := range jobs {
+		select {
+		case next <- k:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	done, skipped, failed := 0, 0, []int{}
+	for k, r := range results {
+		switch {
+		case r.err != nil:
+			failed = append(failed, k)
+		case r.skipped:
+			skipped++
+		case r.done:
+			done++
+		}
+	}
+	fmt.Printf("%d processed, %d up to date, %d failed of %d images in %s\n",
+		done, skipped, len(failed), len(jobs), time.Since(start).Round(time.Millisecond))
+	for _, k := range failed {
+		fmt.Printf("  %s: %v\n", jobs[k].in, results[k].err)
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted, %d images not processed\n", len(jobs)-done-skipped-len(failed))
+		os.Exit(exitInterrupted)
+	}
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// Lists the images of every folder, walked recursively, and glob pattern
+func batchJobs(args []string) ([]batchJob, error) {
+	var jobs []batchJob
+	seen := map[string]bool{}
+	add := func(root string, p string) error {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if !seen[p] {
+			seen[p] = true
+			jobs = append(jobs, batchJob{in: p, rel: rel})
+		}
+		return nil
+	}
+	walk := func(root string, dir string) error {
+		return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() || !imageExts[strings.ToLower(filepath.Ext(p))] {
+				return err
+			}
+			return add(root, p)
+		})
+	}
+
+	for _, a := range args {
+		if fi, err := os.Stat(a); err == nil && fi.IsDir() {
+			if err := walk(a, a); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ms, err := filepath.Glob(a)
+		if err != nil {
+			return nil, err
+		}
+		if len(ms) == 0 {
+			return nil, fmt.Errorf("Error: %q matches no files", a)
+		}
+		root := globRoot(a)
+		for _, m := range ms {
+			if err := walk(root, m); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].in < jobs[b].in })
+	return jobs, nil
+}
+
+// Leading folders of a glob pattern before the first one with a wildcard
+func globRoot(pattern string) string {
+	root := filepath.Dir(pattern)
+	for strings.ContainsAny(root, "*?[") {
+		root = filepath.Dir(root)
+	}
+	return root
+}
+
+func runJob(flags *Flags, opts quads.Options, ro quads.RenderOptions, job batchJob, force bool) batchResult {
+	res := batchResult{}
+	o := filepath.Join(*flags.o, job.rel)
+	if *flags.fm != "" {
+		o = strings.TrimSuffix(o, filepath.Ext(o)) + "." + normalFormat(*flags.fm)
+	}
+	out, err := newOutput(job.in, o, *flags.fm, *flags.q, *flags.nt)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if !force && upToDate(job.in, out.file) {
+		res.skipped = true
+		return res
+	}
+	_, res.err = render(context.Background(), flags, opts, ro, job.in, out)
+	res.done = res.err == nil
+	return res
+}
+
+// Whether out was written after in last changed
+func upToDate(in string, out string) bool {
+	ifi, err := os.Stat(in)
+	if err != nil {
+		return false
+	}
+	ofi, err := os.Stat(out)
+	return err == nil && !ofi.ModTime().Before(ifi.ModTime())
+}
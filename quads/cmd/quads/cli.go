@@ -0,0 +1,174 @@
+// cli.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bradymadden97/go-quads/quads"
+)
+
+type Flags struct {
+	f  *string        //Input filename
+	i  *int           //Iterations
+	b  *bool          //Borders
+	bc *string        //Border/background color
+	bg *string        //Background image filename
+	g  *bool          //to Gif
+	gd *int           //Gif delay per frame in 100th of a second
+	gp *int           //Gif pause before repeat
+	gl *int           //Gif loop count
+	gc *string        //Gif palette
+	gf *bool          //Gif Floyd-Steinberg dithering
+	s  *bool          //Save intermediate images
+	o  *string        //Output file or folder
+	fm *string        //Output image format
+	q  *int           //JPEG quality
+	nt *string        //Name template of saved images
+	p  *bool          //Print progress
+	tm *bool          //Draw final image in the terminal
+	lv *bool          //Redraw the terminal while iterating
+	c  *bool          //Modify quads to circles
+	sh *string        //Shape of quads
+	rr *float64       //Rounded rect corner radius
+	aa *bool          //Anti-alias shape edges
+	ss *int           //Samples per pixel side for shape edges
+	mt *string        //Mosaic tile folder or glob
+	mq *bool          //Match mosaic tiles by quarters
+	mr *float64       //Mosaic tile reuse penalty
+	tx *string        //Glyph text cycled through
+	tr *string        //Glyph brightness ramp
+	tf *string        //Glyph font
+	v  *bool          //Save SVG of final quads
+	e  *bool          //Save encoded quad tree
+	eq *int           //Encoded bits per color channel
+	d  *string        //Decode quad tree filename
+	dw *int           //Decoded render width
+	dh *int           //Decoded render height
+	k  *bool          //Save checkpoint
+	r  *string        //Resume from checkpoint filename
+	cr *bool          //Crop input to power of two dimensions
+	m  *string        //Error metric
+	ap *float64       //Area exponent of split priority
+	dp *float64       //Depth penalty of split priority
+	ml *int           //Minimum quad size
+	n  *int           //Quads split per round
+	w  *int           //Worker goroutines
+	te *float64       //Target total error
+	tp *float64       //Target PSNR
+	ln *int           //Maximum leaf count
+	md *int           //Maximum depth
+	ms *int           //Minimum leaf size
+	t  *time.Duration //Time budget
+	sm *string        //Stop mode
+	cf *string        //Config file or preset name
+
+	noImage bool //Skip the final image, set by the encode command
+}
+
+// Short names of flags, setting the same option
+var flagAliases = map[string]string{"r": "resume"}
+
+// Registers the options shared by every command on fs
+func newFlags(fs *flag.FlagSet) *Flags {
+	flags := Flags{
+		f:  fs.String("f", "", "Input image name, - for stdin"),
+		i:  fs.Int("i", 200, "Number of quad iterations to perform, 0 for no limit"),
+		b:  fs.Bool("b", false, "Adds 1px black border to quads"),
+		bc: fs.String("bc", "0,0,0,255", "Border/ background color between quads: R,G,B[,A], #RRGGBB[AA], a color name or transparent"),
+		bg: fs.String("bg", "", "Background image the quads are composited over, shows through a transparent -bc"),
+		g:  fs.Bool("g", false, "Convert the intermediate images to a GIF"),
+		gd: fs.Int("gd", 5, "Delay per frame in GIF in 100th of a second"),
+		gp: fs.Int("gp", 2, "Pause in seconds at end of GIF loop"),
+		gl: fs.Int("gl", 0, "Number of times to repeat the GIF, 0 loops forever"),
+		gc: fs.String("gc", "global", "GIF palette: global of every frame's colors, frame for each frame, or plan9"),
+		gf: fs.Bool("gf", false, "Dither GIF frames with Floyd-Steinberg to colors missing from the palette"),
+		s:  fs.Bool("s", false, "Save subimages"),
+		o:  fs.String("o", outputFolder, "Output image file, - for stdout, or folder for every output"),
+		fm: fs.String("format", "", "Output image format: png, jpg, tiff, bmp or gif, default from -o or input extension"),
+		q:  fs.Int("q", 95, "JPEG quality, 1 to 100"),
+		nt: fs.String("nt", "{iter}{name}.{ext}", "Name template of saved images, with {name}, {ext} and {iter} or {iter:05}"),
+		p:  fs.Bool("p", false, "Print progress while iterating"),
+		tm: fs.Bool("term", false, "Draw the final image in the terminal with 24-bit colors"),
+		lv: fs.Bool("live", false, "Redraw the image in the terminal while iterating, implies -term"),
+		c:  fs.Bool("c", false, "Modify quads to circles"),
+		sh: fs.String("shape", "", "Shape of quads, overrides -c: "+strings.Join(quads.Shapes(), ", ")),
+		rr: fs.Float64("rr", 4, "Corner radius in pixels of the rounded shape"),
+		aa: fs.Bool("aa", true, "Anti-alias shape edges by pixel coverage"),
+		ss: fs.Int("ss", 0, "Anti-alias shape edges with n by n samples per pixel instead"),
+		mt: fs.String("mt", "", "Fill quads with the best matching image of this folder or glob, as a photo mosaic"),
+		mq: fs.Bool("mq", false, "Match mosaic tiles by the colors of their 2x2 quarters"),
+		mr: fs.Float64("mr", 10, "Color distance added to a mosaic tile for each time it was used"),
+		tx: fs.String("tx", "", "Draw these characters in turn in the quads, as -shape glyphs"),
+		tr: fs.String("tr", quads.DefaultRamp, "Characters of -shape glyphs from least to most ink, picked by contrast with -bc"),
+		tf: fs.String("tf", "mono", "Font of -shape glyphs: "+strings.Join(quads.GlyphFonts(), ", ")),
+		v:  fs.Bool("v", false, "Save final quads as an SVG"),
+		e:  fs.Bool("e", false, "Save final quad tree as a .quad file"),
+		eq: fs.Int("eq", 8, "Bits per color channel in .quad files, 1 to 8"),
+		d:  fs.String("d", "", "Render a .quad file instead of an input image"),
+		dw: fs.Int("dw", 0, "Width to render a .quad file at, 0 keeps aspect ratio"),
+		dh: fs.Int("dh", 0, "Height to render a .quad file at, 0 keeps aspect ratio"),
+		k:  fs.Bool("k", false, "Save a .qckp checkpoint to resume iterations from"),
+		r:  fs.String("resume", "", "Resume iterations of -f from a .qckp checkpoint"),
+		cr: fs.Bool("cr", false, "Crop input image to power of two dimensions"),
+		m:  fs.String("m", "mse", "Error metric: "+strings.Join(quads.Metrics(), ", ")),
+		ap: fs.Float64("ap", 1, "Split priority is mean error * area^ap, 0.5 orders quads like fogleman/Quads without its luma weights"),
+		dp: fs.Float64("dp", 1, "Split priority multiplier per level of depth, below 1 favors shallow quads"),
+		ml: fs.Int("ml", 1, "Minimum width and height of a quad"),
+		n:  fs.Int("n", 1, "Number of quads to split per round, in parallel"),
+		w:  fs.Int("w", 0, "Number of worker goroutines, 0 uses every CPU"),
+		te: fs.Float64("te", 0, "Stop once total error drops to this value"),
+		tp: fs.Float64("tp", 0, "Stop once PSNR in dB reaches this value"),
+		ln: fs.Int("ln", 0, "Stop once this many leaf quads exist"),
+		md: fs.Int("md", 0, "Stop once a quad reaches this depth"),
+		ms: fs.Int("ms", 0, "Stop once a quad's width or height drops to this size"),
+		t:  fs.Duration("t", 0, "Stop once this much time has passed, e.g. 30s"),
+		sm: fs.String("sm", "any", "Stop when any or all of the stop criteria are met"),
+		cf: fs.String("config", "", "JSON file of options, or preset: "+strings.Join(presetNames(), ", ")),
+	}
+	fs.StringVar(flags.r, "r", "", "Alias of -resume")
+	return &flags
+}
+
+// Parses args into fs, then sets the options of the -config file that are
+// not given as flags. Returns the arguments that are not flags, which may come
+// before or between flags.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	rest := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		rest, args = append(rest, fs.Arg(0)), fs.Args()[1:]
+	}
+	cf := fs.Lookup("config").Value.String()
+	if cf == "" {
+		return rest, nil
+	}
+	cfg, err := loadConfig(cf)
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for short, long := range flagAliases {
+		set[short], set[long] = set[short] || set[long], set[short] || set[long]
+	}
+	for _, k := range sortedKeys(cfg) {
+		if k == "config" || fs.Lookup(k) == nil {
+			return nil, fmt.Errorf("Error: unknown option %q in config %s", k, cf)
+		}
+		if set[k] {
+			continue
+		}
+		if err := fs.Set(k, cfg[k]); err != nil {
+			return nil, fmt.Errorf("Error: option %q in config %s: %v", k, cf, err)
+		}
+	}
+	return rest, nil
+}
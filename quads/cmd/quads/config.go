@@ -0,0 +1,68 @@
+// config.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Named configs usable as -config, keyed by flag name like config files
+var presets = map[string]string{
+	"mosaic":  `{"i": 1500, "b": true, "bc": "40,40,40", "ap": 0.25, "ml": 4}`,
+	"bubbles": `{"i": 800, "c": true, "bc": "255,255,255", "ap": 0.5, "ml": 2}`,
+	"fine":    `{"i": 6000, "m": "lab", "ap": 0.25, "n": 8}`,
+}
+
+func presetNames() []string {
+	n := []string{}
+	for k := range presets {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// Reads the options of a JSON config file or preset, an object keyed by
+// flag name, as flag values
+func loadConfig(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) && presets[name] != "" {
+		data, err = []byte(presets[name]), nil
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Error: config %q is not a file or one of the presets %s", name, strings.Join(presetNames(), ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("Error: config %s: %v", name, err)
+	}
+	cfg := map[string]string{}
+	for k, v := range raw {
+		switch v.(type) {
+		case string, bool, json.Number:
+			cfg[k] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("Error: option %q in config %s is not a string, number or boolean", k, name)
+		}
+	}
+	return cfg, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	ks := []string{}
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,122 @@
+// gif.go
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+)
+
+// Bytes of changed areas kept before frames are skipped. Each time frames
+// pass another budget, iterate keeps half as many splits as before.
+const gifFrameBudget = 256 << 20
+
+// GIF frames of iterate. Only the area that changed since the previous frame
+// is kept, the first frame is whole. Frames are drawn over the ones before,
+// so a changed area that is not opaque grows the previous frame to cover it
+// and disposes it to the transparent background first.
+type gifFrames struct {
+	last     *image.NRGBA       //Image of the last frame
+	frames   []*image.NRGBA     //Changed area of each frame
+	delays   []int              //Splits each frame is shown for
+	disposal []byte             //Disposal method of each frame
+	counts   map[color.RGBA]int //Pixels of each color in every frame, for the global palette
+	bytes    int                //Pixel bytes of frames
+	budget   int                //Bytes of frames before stride doubles
+	stride   int                //Splits per frame
+	skip     int                //Splits since the last frame
+}
+
+func newGIFFrames(mode string) *gifFrames {
+	gf := &gifFrames{budget: gifFrameBudget, stride: 1}
+	if mode == "global" {
+		gf.counts = map[color.RGBA]int{}
+	}
+	return gf
+}
+
+// Adds img as the next frame, keeping the area that differs from the last
+func (gf *gifFrames) add(img *image.NRGBA) {
+	if gf.last == nil {
+		gf.last = image.NewNRGBA(img.Bounds())
+		gf.keep(img, img.Bounds())
+		return
+	}
+	if gf.skip++; gf.skip < gf.stride {
+		return
+	}
+	gf.skip = 0
+	r := changedRect(gf.last, img)
+	if r.Empty() {
+		gf.delays[len(gf.delays)-1]++
+		return
+	}
+	if !opaque(img, r) {
+		r = gf.dispose(r)
+	}
+	gf.keep(img, r)
+	if gf.bytes > gf.budget {
+		gf.stride, gf.budget = gf.stride*2, gf.budget+gifFrameBudget
+	}
+}
+
+func (gf *gifFrames) keep(img *image.NRGBA, r image.Rectangle) {
+	f := image.NewNRGBA(r)
+	draw.Draw(f, r, img, r.Min, draw.Src)
+	draw.Draw(gf.last, r, img, r.Min, draw.Src)
+	gf.frames = append(gf.frames, f)
+	gf.delays = append(gf.delays, 1)
+	gf.disposal = append(gf.disposal, gif.DisposalNone)
+	gf.bytes += len(f.Pix)
+	if gf.counts != nil {
+		countColors(gf.counts, f)
+	}
+}
+
+// Grows the last frame over r with the image it shows and disposes it to the
+// background, clearing r before the next frame. Returns the area the next
+// frame has to redraw.
+func (gf *gifFrames) dispose(r image.Rectangle) image.Rectangle {
+	n := len(gf.frames) - 1
+	r = r.Union(gf.frames[n].Bounds())
+	f := image.NewNRGBA(r)
+	draw.Draw(f, r, gf.last, r.Min, draw.Src)
+	gf.bytes += len(f.Pix) - len(gf.frames[n].Pix)
+	gf.frames[n], gf.disposal[n] = f, gif.DisposalBackground
+	return r
+}
+
+// Whether every pixel of img in r is opaque
+func opaque(img *image.NRGBA, r image.Rectangle) bool {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for i := img.PixOffset(r.Min.X, y) + 3; i < img.PixOffset(r.Max.X, y); i += 4 {
+			if img.Pix[i] < 0xff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Bounds of the pixels that differ between a and b of the same bounds
+func changedRect(a *image.NRGBA, b *image.NRGBA) image.Rectangle {
+	bd := a.Bounds()
+	r := image.Rectangle{}
+	for y := bd.Min.Y; y < bd.Max.Y; y++ {
+		ra, rb := a.Pix[a.PixOffset(bd.Min.X, y):a.PixOffset(bd.Max.X, y)], b.Pix[b.PixOffset(bd.Min.X, y):b.PixOffset(bd.Max.X, y)]
+		if bytes.Equal(ra, rb) {
+			continue
+		}
+		x0, x1 := 0, len(ra)/4
+		for x0 < x1 && bytes.Equal(ra[4*x0:4*x0+4], rb[4*x0:4*x0+4]) {
+			x0++
+		}
+		for x1 > x0 && bytes.Equal(ra[4*x1-4:4*x1], rb[4*x1-4:4*x1]) {
+			x1--
+		}
+		r = r.Union(image.Rect(bd.Min.X+x0, y, bd.Min.X+x1, y+1))
+	}
+	return r
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+
+	"github.com/bradymadden97/go-quads/quads"
+)
+
+// Quads turning transparent between circles have to clear in the GIF, whose
+// frames only draw over the ones before
+func TestGIFTransparent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 2), uint8(y * 3), uint8(x ^ y), 255})
+		}
+	}
+	opts := quads.DefaultOptions()
+	opts.Iterations = 30
+	tr, err := quads.New(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro := quads.RenderOptions{Circle: true, Color: color.NRGBA{}}
+	gf := newGIFFrames("global")
+	if err := iterate(context.Background(), tr, ro, nil, false, gf, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := toGIF(&buf, gf, 10, 0, 0, "global", false); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cv := image.NewRGBA(tr.Root().Bounds())
+	for i, f := range g.Image {
+		draw.Draw(cv, f.Bounds(), f, f.Bounds().Min, draw.Over)
+		if i < len(g.Disposal)-1 && g.Disposal[i] == gif.DisposalBackground {
+			draw.Draw(cv, f.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	want, diff := tr.Render(ro), 0
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if rgbaAt(want, x, y) != cv.RGBAAt(x, y) {
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		t.Errorf("%d of %d pixels of the layered frames differ from the render", diff, b.Dx()*b.Dy())
+	}
+}
@@ -0,0 +1,521 @@
+// main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bradymadden97/go-quads/quads"
+)
+
+// Exit code after an interrupt, once the current image has been written
+const exitInterrupted int = 130
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"render", "Run quads on an image and save the result, the default command", runRender},
+	{"encode", "Run quads on an image and save the quad tree as a .quad file", runEncode},
+	{"decode", "Render a .quad file", runDecode},
+	{"info", "Print the size and quad stats of an image, .quad or .qckp file", runInfo},
+	{"batch", "Run quads on every image in folders and globs", runBatch},
+	{"serve", "Run quads on images posted over HTTP", runServe},
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage()
+	}
+	name := "render"
+	if !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+	usage()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: quads <command> [flags] [input]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun quads <command> -h for the flags of a command.")
+	os.Exit(2)
+}
+
+// Parses the flags of command name, returning the arguments that are not flags
+func commandFlags(name string, args []string) (*Flags, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	flags := newFlags(fs)
+	rest, err := parseFlags(fs, args)
+	return flags, rest, err
+}
+
+// Takes the input of a command from flag in or its one argument
+func commandInput(name string, in *string, args []string) error {
+	if len(args) > 1 || len(args) == 1 && *in != "" {
+		return fmt.Errorf("Error: %s takes one input, got %s", name, strings.Join(append(args, *in), " "))
+	}
+	if len(args) == 1 {
+		*in = args[0]
+	}
+	if *in == "" {
+		return fmt.Errorf("Error: %s needs an input file as an argument", name)
+	}
+	return nil
+}
+
+func runRender(args []string) error {
+	flags, rest, err := commandFlags("render", args)
+	if err != nil {
+		return err
+	}
+	//Rendering a .quad file with -d predates the decode command
+	if *flags.d != "" {
+		if err := commandInput("decode", flags.d, rest); err != nil {
+			return err
+		}
+		return decodeFile(flags)
+	}
+	if err := commandInput("render", flags.f, rest); err != nil {
+		return err
+	}
+	return renderImage(flags)
+}
+
+func runEncode(args []string) error {
+	flags, rest, err := commandFlags("encode", args)
+	if err != nil {
+		return err
+	}
+	if err := commandInput("encode", flags.f, rest); err != nil {
+		return err
+	}
+	*flags.e, flags.noImage = true, true
+	return renderImage(flags)
+}
+
+func runDecode(args []string) error {
+	flags, rest, err := commandFlags("decode", args)
+	if err != nil {
+		return err
+	}
+	if err := commandInput("decode", flags.d, rest); err != nil {
+		return err
+	}
+	return decodeFile(flags)
+}
+
+func decodeFile(flags *Flags) error {
+	out, err := newOutput(*flags.d, *flags.o, *flags.fm, *flags.q, *flags.nt)
+	if err != nil {
+		return err
+	}
+	ro, err := renderOptions(flags)
+	if err != nil {
+		return err
+	}
+	return decode(flags, ro, out)
+}
+
+// Runs quads on the -f image, exiting with exitInterrupted once the outputs
+// are written after an interrupt
+func renderImage(flags *Flags) error {
+	out, err := newOutput(*flags.f, *flags.o, *flags.fm, *flags.q, *flags.nt)
+	if err != nil {
+		return err
+	}
+	ro, err := renderOptions(flags)
+	if err != nil {
+		return err
+	}
+	opts, err := treeOptions(flags)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	t, err := render(ctx, flags, opts, ro, *flags.f, out)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("Interrupted after %d iterations", t.Stats().Iterations)
+		os.Exit(exitInterrupted)
+	}
+	return nil
+}
+
+func runInfo(args []string) error {
+	flags, rest, err := commandFlags("info", args)
+	if err != nil {
+		return err
+	}
+	ins := rest
+	for _, in := range []string{*flags.d, *flags.r} {
+		if in != "" {
+			ins = append(ins, in)
+		}
+	}
+	if len(ins) == 0 && *flags.f != "" {
+		ins = []string{*flags.f}
+	}
+	if len(ins) == 0 {
+		return fmt.Errorf("Error: info needs an image, .quad or .qckp file")
+	}
+	for _, in := range ins {
+		if err := info(flags, in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func info(flags *Flags, in string) error {
+	var t *quads.Tree
+	switch strings.ToLower(filepath.Ext(in)) {
+	case ".quad":
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		t, err = quads.Decode(f)
+		if err != nil {
+			return err
+		}
+	case ".qckp":
+		if *flags.f == "" {
+			return fmt.Errorf("Error: info of checkpoint %s needs its image as -f", in)
+		}
+		img, err := openImage(*flags.f)
+		if err != nil {
+			return err
+		}
+		t, err = newTree(img, quads.Options{}, in)
+		if err != nil {
+			return err
+		}
+	default:
+		f, err := os.Stdin, error(nil)
+		if in != stdio {
+			f, err = os.Open(in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+		cfg, format, err := image.DecodeConfig(f)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s image %dx%d\n", in, format, cfg.Width, cfg.Height)
+		return nil
+	}
+
+	st, b := t.Stats(), t.Root().Bounds()
+	fmt.Printf("%s: %dx%d, %d iterations, %d quads, depth %d, smallest quad %dpx", in, b.Dx(), b.Dy(), st.Iterations, st.Leaves, st.Depth, st.MinSize)
+	if st.PSNR > 0 {
+		fmt.Printf(", psnr %.2fdB", st.PSNR)
+	}
+	fmt.Println()
+	return nil
+}
+
+// Context canceled by SIGINT or SIGTERM. Once canceled a second interrupt
+// kills the process while outputs are written.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+func renderOptions(flags *Flags) (quads.RenderOptions, error) {
+	cl, err := decodeColor(*flags.bc)
+	if err != nil {
+		return quads.RenderOptions{}, err
+	}
+	if *flags.ss > quads.MaxSupersample {
+		return quads.RenderOptions{}, fmt.Errorf("Error: -ss %d samples is over the maximum of %d", *flags.ss, quads.MaxSupersample)
+	}
+	ro := quads.RenderOptions{Border: *flags.b, Circle: *flags.c, Color: cl, Radius: *flags.rr, AntiAlias: *flags.aa, Supersample: *flags.ss}
+	switch {
+	case *flags.tx != "" && *flags.sh != "" && *flags.sh != "glyphs":
+		return quads.RenderOptions{}, fmt.Errorf("Error: -tx draws -shape glyphs, not %s", *flags.sh)
+	case *flags.sh == "glyphs" || *flags.tx != "":
+		g, err := quads.NewGlyphs(*flags.tf)
+		if err != nil {
+			return quads.RenderOptions{}, err
+		}
+		g.Text, g.Ramp = *flags.tx, *flags.tr
+		ro.Shape = g
+	case *flags.sh != "":
+		ro.Shape, err = quads.ShapeByName(*flags.sh)
+		if err != nil {
+			return quads.RenderOptions{}, err
+		}
+	}
+	if *flags.mt != "" {
+		if ro.Shape != nil {
+			return quads.RenderOptions{}, fmt.Errorf("Error: -mt can not be combined with -shape or -tx")
+		}
+		ro.Shape, err = loadMosaic(*flags.mt, *flags.mq, *flags.mr)
+		if err != nil {
+			return quads.RenderOptions{}, err
+		}
+	}
+	if *flags.bg != "" {
+		ro.Background, err = openImage(*flags.bg)
+		if err != nil {
+			return quads.RenderOptions{}, err
+		}
+	}
+	return ro, nil
+}
+
+func treeOptions(flags *Flags) (quads.Options, error) {
+	all, err := stopMode(*flags.sm)
+	if err != nil {
+		return quads.Options{}, err
+	}
+	if *flags.n < 1 {
+		return quads.Options{}, fmt.Errorf("Error: -n %d quads per round is not at least 1", *flags.n)
+	}
+	if *flags.w < 0 {
+		return quads.Options{}, fmt.Errorf("Error: -w %d workers is negative", *flags.w)
+	}
+	return quads.Options{
+		Metric:       *flags.m,
+		AreaPower:    *flags.ap,
+		DepthPenalty: *flags.dp,
+		MinSize:      *flags.ml,
+		Crop:         *flags.cr,
+		Batch:        *flags.n,
+		Workers:      *flags.w,
+		Iterations:   *flags.i,
+		TargetError:  *flags.te,
+		TargetPSNR:   *flags.tp,
+		MaxLeaves:    *flags.ln,
+		MaxDepth:     *flags.md,
+		MinLeafSize:  *flags.ms,
+		Timeout:      *flags.t,
+		StopAll:      all,
+	}, nil
+}
+
+// Runs quads on the image in until done or ctx is canceled, then writes the
+// final image and every other requested output
+func render(ctx context.Context, flags *Flags, opts quads.Options, ro quads.RenderOptions, in string, out *Output) (*quads.Tree, error) {
+	if *flags.g && !gifPalettes[*flags.gc] {
+		return nil, fmt.Errorf("Error: GIF palette %q not global, frame or plan9", *flags.gc)
+	}
+	img, err := openImage(in)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTree(img, opts, *flags.r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tv *termView
+	if *flags.tm || *flags.lv {
+		if *flags.o == stdio {
+			return nil, fmt.Errorf("Error: -term and -o - both write to stdout")
+		}
+		tv = newTermView()
+	}
+	live := tv
+	if !*flags.lv {
+		live = nil
+	}
+	var gf *gifFrames
+	if *flags.g {
+		gf = newGIFFrames(*flags.gc)
+	}
+	err = iterate(ctx, t, ro, out, *flags.s, gf, *flags.p, live)
+	if err != nil {
+		return nil, err
+	}
+
+	if tv != nil {
+		err = tv.draw(t.Render(ro))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !flags.noImage {
+		err = out.saveImage(t.Render(ro), t.Stats().Iterations, opts.Iterations, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if gf != nil {
+		err = out.write(".gif", func(w io.Writer) error { return toGIF(w, gf, *flags.gd, *flags.gp, *flags.gl, *flags.gc, *flags.gf) })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if *flags.v {
+		err = out.write(".svg", func(w io.Writer) error { return t.WriteSVG(w, ro) })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if *flags.e {
+		err = out.write(".quad", func(w io.Writer) error { return t.Encode(w, *flags.eq) })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if *flags.k {
+		err = out.write(".qckp", t.WriteCheckpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func newTree(img image.Image, opts quads.Options, resume string) (*quads.Tree, error) {
+	if resume == "" {
+		return quads.New(img, opts)
+	}
+	f, err := os.Open(resume)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return quads.Resume(img, f, opts)
+}
+
+// Runs the tree, saving -s frames, keeping -g frames and redrawing live when
+// not nil. The final image is rendered from the finished tree, as shapes like
+// mosaics draw a whole tree differently than one split at a time.
+func iterate(ctx context.Context, t *quads.Tree, ro quads.RenderOptions, out *Output, s bool, gf *gifFrames, p bool, live *termView) error {
+	itr := t.Options().Iterations
+	obs := []quads.Observer{}
+	if s || gf != nil || live != nil {
+		past_img := t.Render(ro)
+		var drawn time.Time
+		if live != nil {
+			if err := live.draw(past_img); err != nil {
+				return err
+			}
+			drawn = time.Now()
+		}
+		if gf != nil {
+			gf.add(past_img)
+		}
+		if s && !t.Done() {
+			err := out.saveImage(past_img, t.Stats().Iterations, itr, false)
+			if err != nil {
+				return err
+			}
+		}
+		obs = append(obs, func(sp quads.Split) error {
+			t.Draw(past_img, ro, sp.Children[:]...)
+			if s && !t.Done() {
+				err := out.saveImage(past_img, sp.Iteration, itr, false)
+				if err != nil {
+					return err
+				}
+			}
+			if gf != nil {
+				gf.add(past_img)
+			}
+			//The final image is drawn after Run
+			if live != nil && time.Since(drawn) >= 100*time.Millisecond && !t.Done() {
+				drawn = time.Now()
+				return live.draw(past_img)
+			}
+			return nil
+		})
+	}
+	if p {
+		obs = append(obs, progress(t))
+	}
+	err := t.Run(ctx, obs...)
+	if p {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func progress(t *quads.Tree) quads.Observer {
+	var last time.Time
+	return func(sp quads.Split) error {
+		if time.Since(last) < 100*time.Millisecond && !t.Done() {
+			return nil
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\riteration %d  quads %d  error %.4g  psnr %.2fdB ", sp.Iteration, t.Stats().Leaves, sp.Error, t.Stats().PSNR)
+		return nil
+	}
+}
+
+func decode(flags *Flags, ro quads.RenderOptions, out *Output) error {
+	f, err := os.Open(*flags.d)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	t, err := quads.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	ro.Width, ro.Height = *flags.dw, *flags.dh
+	img := t.Render(ro)
+	if img.Bounds().Empty() {
+		return fmt.Errorf("Error: render size %dx%d too small", ro.Width, ro.Height)
+	}
+
+	//A decoded tree has no iterations to number the image with
+	out.tmpl = "{name}.{ext}"
+	err = out.saveImage(img, 0, 0, true)
+	if err != nil {
+		return err
+	}
+	if *flags.v {
+		return out.write(".svg", func(w io.Writer) error { return t.WriteSVG(w, ro) })
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// output.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+const outputFolder string = "./out/"
+
+// Input and output name for stdin and stdout
+const stdio string = "-"
+
+var formats = map[string]imaging.Format{
+	"png":  imaging.PNG,
+	"jpg":  imaging.JPEG,
+	"tiff": imaging.TIFF,
+	"bmp":  imaging.BMP,
+	"gif":  imaging.GIF,
+}
+
+var templateField = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+
+type Output struct {
+	dir     string //Folder for every output
+	name    string //Base name of outputs, without extension
+	file    string //Final image path, empty to name it with the template
+	format  string //Image format and extension
+	quality int    //JPEG quality
+	tmpl    string //Name template of saved images
+}
+
+// Resolves where outputs of the input image go. o is the final image path
+// when it has an extension and is not an existing folder, and the other
+// outputs share its name. Otherwise o is the folder for every output. With
+// o "-" the final image goes to stdout and the other outputs to ./out/.
+func newOutput(in string, o string, format string, quality int, tmpl string) (*Output, error) {
+	if o == "" {
+		o = "."
+	}
+	out := &Output{dir: o, name: splitName(filepath.Base(in)), quality: quality, tmpl: tmpl}
+	ext := filepath.Ext(in)
+	if in == stdio {
+		out.name, ext = "stdin", ""
+	}
+	if o == stdio {
+		out.dir, out.file = outputFolder, stdio
+	} else if isFile(o) {
+		out.dir, out.file = filepath.Dir(o), o
+		out.name, ext = splitName(filepath.Base(o)), filepath.Ext(o)
+	}
+	format = pickFormat(format, ext)
+	if _, ok := formats[format]; !ok {
+		return nil, fmt.Errorf("Error: output format %q not png, jpg, tiff, bmp or gif", format)
+	}
+	if quality < 1 || quality > 100 {
+		return nil, fmt.Errorf("Error: JPEG quality %d not between 1 and 100", quality)
+	}
+	out.format = format
+	if _, err := out.expand(0, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Path of an image saved after itr of max iterations, the final image when
+// it is the -o file
+func (out *Output) imagePath(itr int, max int, final bool) (string, error) {
+	if final && out.file != "" {
+		return out.file, nil
+	}
+	n, err := out.expand(itr, max)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(out.dir, n), nil
+}
+
+// Fills the {name}, {ext} and {iter} fields of the name template. {iter} is
+// zero padded to the digits of max, or to the width given as {iter:05}.
+func (out *Output) expand(itr int, max int) (string, error) {
+	var err error
+	n := templateField.ReplaceAllStringFunc(out.tmpl, func(s string) string {
+		m := templateField.FindStringSubmatch(s)
+		switch m[1] {
+		case "name":
+			return out.name
+		case "ext":
+			return out.format
+		case "iter":
+			w := len(strconv.Itoa(max))
+			if m[2] != "" {
+				w, _ = strconv.Atoi(m[2])
+			}
+			return fmt.Sprintf("%0*d", w, itr)
+		}
+		err = fmt.Errorf("Error: unknown name template field %q", s)
+		return s
+	})
+	return n, err
+}
+
+func (out *Output) saveImage(img *image.NRGBA, itr int, max int, final bool) error {
+	p, err := out.imagePath(itr, max, final)
+	if err != nil {
+		return err
+	}
+	if p == stdio {
+		return encodeImage(os.Stdout, img, out.format, out.quality)
+	}
+	f, err := out.create(p)
+	if err != nil {
+		return err
+	}
+	err = encodeImage(f, img, out.format, out.quality)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Writes the output with extension ext next to the images
+func (out *Output) write(ext string, write func(w io.Writer) error) error {
+	f, err := out.create(filepath.Join(out.dir, out.name+ext))
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Creates the output folder when first written to, so streaming to stdout
+// leaves no empty folder behind
+func (out *Output) create(p string) (*os.File, error) {
+	if err := os.MkdirAll(out.dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func encodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	if formats[format] == imaging.JPEG {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	if formats[format] == imaging.GIF {
+		return gif.Encode(w, img, &gif.Options{NumColors: 256, Quantizer: medianCut{}})
+	}
+	return imaging.Encode(w, img, formats[format])
+}
+
+// Format from the -format flag, otherwise from the file extension ext when
+// it is an image format, otherwise png
+func pickFormat(format string, ext string) string {
+	if format == "" {
+		format = normalFormat(strings.TrimPrefix(ext, "."))
+		if _, ok := formats[format]; !ok {
+			return "png"
+		}
+	}
+	return normalFormat(format)
+}
+
+func normalFormat(format string) string {
+	format = strings.ToLower(format)
+	switch format {
+	case "jpeg":
+		return "jpg"
+	case "tif":
+		return "tiff"
+	}
+	return format
+}
+
+// Whether the -o value names a file rather than a folder
+func isFile(o string) bool {
+	if filepath.Ext(o) == "" {
+		return false
+	}
+	fi, err := os.Stat(o)
+	return err != nil || !fi.IsDir()
+}
+
+func splitName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
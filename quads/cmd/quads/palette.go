@@ -0,0 +1,185 @@
+// palette.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"sort"
+)
+
+// GIF palettes of the -gc flag
+var gifPalettes = map[string]bool{"global": true, "frame": true, "plan9": true}
+
+// Quantizer using the exact colors of an image when it has few enough,
+// otherwise a median cut of them
+type medianCut struct{}
+
+func (medianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	counts := map[color.RGBA]int{}
+	countColors(counts, m)
+	return append(p, buildPalette(counts, cap(p)-len(p))...)
+}
+
+// Adds the number of pixels of each color of img to counts
+func countColors(counts map[color.RGBA]int, img image.Image) {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[rgbaAt(img, x, y)]++
+		}
+	}
+}
+
+// Color of img at x, y like color.RGBAModel, without its allocation for the
+// NRGBA images of frames
+func rgbaAt(img image.Image, x int, y int) color.RGBA {
+	n, ok := img.(*image.NRGBA)
+	if !ok {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+	o := n.PixOffset(x, y)
+	a := uint32(n.Pix[o+3])
+	mul := func(v uint8) uint8 { return uint8(uint32(v) * 0x101 * a / 0xff >> 8) }
+	return color.RGBA{mul(n.Pix[o]), mul(n.Pix[o+1]), mul(n.Pix[o+2]), n.Pix[o+3]}
+}
+
+type colorCount struct {
+	c color.RGBA
+	n int //Pixels of the color
+}
+
+// Palette of at most n colors: every color of counts when there are at most
+// n, otherwise the average colors of n boxes split at the pixel median of
+// their widest channel. Full transparency keeps its own entry.
+func buildPalette(counts map[color.RGBA]int, n int) color.Palette {
+	pal := color.Palette{}
+	if _, ok := counts[color.RGBA{}]; ok {
+		pal, n = append(pal, color.RGBA{}), n-1
+	}
+	cs := []colorCount{}
+	for c, k := range counts {
+		if c != (color.RGBA{}) {
+			cs = append(cs, colorCount{c, k})
+		}
+	}
+	//Sorted so the palette does not depend on map order
+	sort.Slice(cs, func(a, b int) bool { return rgbaKey(cs[a].c) < rgbaKey(cs[b].c) })
+	if len(cs) <= n {
+		for _, c := range cs {
+			pal = append(pal, c.c)
+		}
+		return pal
+	}
+
+	boxes := [][]colorCount{cs}
+	for len(boxes) < n {
+		//Split the box with the most squared error along its widest channel
+		bi, bch, be := -1, 0, 0.0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if ch, e := widestChannel(b); e > be {
+				bi, bch, be = i, ch, e
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		b := boxes[bi]
+		sort.SliceStable(b, func(x, y int) bool { return channel(b[x].c, bch) < channel(b[y].c, bch) })
+		total := 0
+		for _, c := range b {
+			total += c.n
+		}
+		m, sum := 1, b[0].n
+		for m < len(b)-1 && 2*sum < total {
+			sum += b[m].n
+			m++
+		}
+		boxes[bi] = b[:m]
+		boxes = append(boxes, b[m:])
+	}
+	for _, b := range boxes {
+		var s [4]int
+		total := 0
+		for _, c := range b {
+			for ch := 0; ch < 4; ch++ {
+				s[ch] += channel(c.c, ch) * c.n
+			}
+			total += c.n
+		}
+		pal = append(pal, color.RGBA{uint8(s[0] / total), uint8(s[1] / total), uint8(s[2] / total), uint8(s[3] / total)})
+	}
+	return pal
+}
+
+func channel(c color.RGBA, ch int) int {
+	return int([4]uint8{c.R, c.G, c.B, c.A}[ch])
+}
+
+func rgbaKey(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+// Channel with the largest pixel variance in b, and its squared error
+func widestChannel(b []colorCount) (int, float64) {
+	bch, be := 0, -1.0
+	for ch := 0; ch < 4; ch++ {
+		var n, s, sq float64
+		for _, c := range b {
+			v := float64(channel(c.c, ch))
+			n, s, sq = n+float64(c.n), s+v*float64(c.n), sq+v*v*float64(c.n)
+		}
+		if e := sq - s*s/n; e > be {
+			bch, be = ch, e
+		}
+	}
+	return bch, be
+}
+
+// Converts img to pal, by nearest colors or with Floyd-Steinberg dithering.
+// Nearest colors are kept in index, shared by frames of the same palette.
+func toPaletted(img image.Image, pal color.Palette, dither bool, index map[color.RGBA]uint8) *image.Paletted {
+	b := img.Bounds()
+	p := image.NewPaletted(b, pal)
+	if dither {
+		draw.FloydSteinberg.Draw(p, b, img, b.Min)
+		return p
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := rgbaAt(img, x, y)
+			k, ok := index[c]
+			if !ok {
+				k = uint8(pal.Index(c))
+				index[c] = k
+			}
+			p.Pix[p.PixOffset(x, y)] = k
+		}
+	}
+	return p
+}
+
+// Palette of each frame for the -gc palette mode
+func gifFramePalettes(gf *gifFrames, mode string) []color.Palette {
+	pals := make([]color.Palette, len(gf.frames))
+	switch mode {
+	case "plan9":
+		for i := range pals {
+			pals[i] = palette.Plan9
+		}
+	case "frame":
+		for i, img := range gf.frames {
+			pals[i] = medianCut{}.Quantize(make(color.Palette, 0, 256), img)
+		}
+	default:
+		pal := buildPalette(gf.counts, 256)
+		for i := range pals {
+			pals[i] = pal
+		}
+	}
+	return pals
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBuildPaletteExact(t *testing.T) {
+	counts := map[color.RGBA]int{{}: 7}
+	for i := 0; i < 255; i++ {
+		counts[color.RGBA{uint8(i), uint8(255 - i), 9, 255}] = i + 1
+	}
+	pal := buildPalette(counts, 256)
+	if len(pal) != 256 {
+		t.Fatalf("palette of %d colors, want 256", len(pal))
+	}
+	if pal[0] != (color.RGBA{}) {
+		t.Errorf("first entry %v, want transparent", pal[0])
+	}
+	for _, c := range pal[1:] {
+		if _, ok := counts[c.(color.RGBA)]; !ok || c == (color.RGBA{}) {
+			t.Errorf("entry %v is not one of the colors", c)
+		}
+		delete(counts, c.(color.RGBA))
+	}
+	if len(counts) != 1 {
+		t.Errorf("%d colors missing from the palette", len(counts)-1)
+	}
+}
+
+func TestBuildPaletteMedianCut(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	cs := []color.RGBA{{}}
+	for i := 0; i < 5000; i++ {
+		cs = append(cs, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+	}
+	build := func(order []int) color.Palette {
+		counts := map[color.RGBA]int{}
+		for _, i := range order {
+			counts[cs[i]] += i%5 + 1
+		}
+		return buildPalette(counts, 64)
+	}
+	pal := build(rnd.Perm(len(cs)))
+	if len(pal) != 64 {
+		t.Fatalf("palette of %d colors, want 64", len(pal))
+	}
+	if pal[0] != (color.RGBA{}) {
+		t.Errorf("first entry %v, want transparent", pal[0])
+	}
+	for k := 0; k < 3; k++ {
+		if again := build(rnd.Perm(len(cs))); !reflect.DeepEqual(again, pal) {
+			t.Fatal("palette depends on the order colors were counted")
+		}
+	}
+
+	//Quantize fills the capacity left after the given colors
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+	}
+	if q := (medianCut{}).Quantize(append(make(color.Palette, 0, 32), color.Black), img); len(q) != 32 {
+		t.Errorf("quantized to %d colors, want 32", len(q))
+	}
+}
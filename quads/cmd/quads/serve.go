@@ -0,0 +1,188 @@
+// serve.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bradymadden97/go-quads/quads"
+)
+
+// Flags a request can not set, as they name files on the server, outputs
+// other than the response, like the server's terminal, or the server's
+// memory and CPU use
+var serveExcluded = map[string]bool{
+	"f": true, "d": true, "resume": true, "r": true, "o": true, "bg": true, "nt": true, "s": true, "p": true,
+	"g": true, "gd": true, "gp": true, "gl": true, "gc": true, "gf": true, "e": true, "eq": true, "k": true, "dw": true, "dh": true, "mt": true,
+	"term": true, "live": true, "ss": true, "n": true, "w": true,
+}
+
+// Returned by the observer stopping a request at the server's -maxi
+var errServeLimit = errors.New("Error: request reached the server's iteration limit")
+
+// Limits of the server on what a request can ask for
+type serveLimits struct {
+	bytes  int64         //Largest image upload in bytes
+	pixels int           //Largest image in pixels
+	itr    int           //Most iterations per request
+	time   time.Duration //Longest run per request
+}
+
+var contentTypes = map[string]string{
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+	"tiff": "image/tiff",
+	"bmp":  "image/bmp",
+	"gif":  "image/gif",
+	"svg":  "image/svg+xml",
+}
+
+// Serves POST / with an image body, responding with its quads image, or SVG
+// with format=svg. Query parameters set options by flag name, like
+// ?i=500&c=true&format=jpg, over the options the server was started with.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	newFlags(fs)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	lim := serveLimits{}
+	fs.Int64Var(&lim.bytes, "max", 32<<20, "Largest image upload in bytes")
+	fs.IntVar(&lim.pixels, "maxpx", 4096*4096, "Largest image upload in pixels")
+	fs.IntVar(&lim.itr, "maxi", 20000, "Most iterations per request, also for i=0")
+	fs.DurationVar(&lim.time, "maxt", 30*time.Second, "Longest run per request, also for t=0")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	defaults := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { defaults[f.Name] = f.Value.String() })
+	delete(defaults, "config")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "POST an image to run quads on, with options as query parameters like ?i=500&c=true&format=jpg", http.StatusMethodNotAllowed)
+			return
+		}
+		start := time.Now()
+		body, ctype, status, err := serveImage(r, defaults, lim)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			log.Printf("%s %s: %d %v", r.Method, r.URL, status, err)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Write(body)
+		log.Printf("%s %s: %d %s", r.Method, r.URL, status, time.Since(start).Round(time.Millisecond))
+	})
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	ctx, stop := interruptContext()
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Printf("Serving quads on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Runs quads on the request body and returns the encoded response with its
+// content type, or an error with its HTTP status
+func serveImage(r *http.Request, defaults map[string]string, lim serveLimits) ([]byte, string, int, error) {
+	fs := flag.NewFlagSet("request", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	flags := newFlags(fs)
+	args := []string{}
+	for k, vs := range r.URL.Query() {
+		if serveExcluded[k] {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("Error: option %q can not be set by a request", k)
+		}
+		if k == "config" && presets[vs[0]] == "" {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("Error: config %q is not a preset", vs[0])
+		}
+		args = append(args, "-"+k+"="+vs[len(vs)-1])
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for k, v := range defaults {
+		if !set[k] && fs.Lookup(k) != nil {
+			fs.Set(k, v)
+		}
+	}
+
+	format := pickFormat(*flags.fm, "")
+	if *flags.v || format == "svg" {
+		format = "svg"
+	} else if _, ok := formats[format]; !ok {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("Error: output format %q not png, jpg, tiff, bmp or gif", format)
+	}
+	ro, err := renderOptions(flags)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+	opts, err := treeOptions(flags)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, lim.bytes))
+	if err != nil {
+		return nil, "", http.StatusRequestEntityTooLarge, err
+	}
+	//Check the size before decoding allocates the pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+	if cfg.Width*cfg.Height > lim.pixels {
+		return nil, "", http.StatusRequestEntityTooLarge, fmt.Errorf("Error: image of %dx%d pixels over the server's limit of %d", cfg.Width, cfg.Height, lim.pixels)
+	}
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+	t, err := quads.New(img, opts)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+	//The limits end the run like the stop criteria, whatever -sm is
+	ctx, cancel := context.WithTimeout(r.Context(), lim.time)
+	defer cancel()
+	err = t.Run(ctx, func(sp quads.Split) error {
+		if sp.Iteration >= lim.itr {
+			return errServeLimit
+		}
+		return nil
+	})
+	if r.Context().Err() != nil {
+		return nil, "", http.StatusServiceUnavailable, r.Context().Err()
+	}
+	if err != nil && err != errServeLimit && err != context.DeadlineExceeded {
+		return nil, "", http.StatusInternalServerError, err
+	}
+
+	var buf bytes.Buffer
+	if format == "svg" {
+		err = t.WriteSVG(&buf, ro)
+	} else {
+		err = encodeImage(&buf, t.Render(ro), format, *flags.q)
+	}
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, err
+	}
+	return buf.Bytes(), contentTypes[format], http.StatusOK, nil
+}
@@ -0,0 +1,80 @@
+// term.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// Draws images to a terminal with 24-bit ANSI colors, two pixels per
+// character with the upper half block, each image over the last one
+type termView struct {
+	w     io.Writer
+	lines int //Lines of the last image drawn
+}
+
+func newTermView() *termView {
+	return &termView{w: os.Stdout}
+}
+
+// Draws img scaled down to fit the terminal, leaving a line for the prompt
+func (tv *termView) draw(img image.Image) error {
+	cols, rows := termSize()
+	px := imaging.Fit(img, cols, 2*(rows-1), imaging.Box)
+	w, h := px.Bounds().Dx(), px.Bounds().Dy()
+
+	b := bufio.NewWriter(tv.w)
+	if tv.lines > 0 {
+		fmt.Fprintf(b, "\r\x1b[%dA", tv.lines)
+	}
+	//Pixels composited over black, as the terminal background is unknown
+	rgb := func(x int, y int) [3]int {
+		o := px.PixOffset(x, y)
+		p := px.Pix[o : o+4]
+		return [3]int{int(p[0]) * int(p[3]) / 255, int(p[1]) * int(p[3]) / 255, int(p[2]) * int(p[3]) / 255}
+	}
+	for y := 0; y < h; y += 2 {
+		fg, bg := [3]int{-1}, [3]int{-1}
+		for x := 0; x < w; x++ {
+			if c := rgb(x, y); c != fg {
+				fg = c
+				fmt.Fprintf(b, "\x1b[38;2;%d;%d;%dm", c[0], c[1], c[2])
+			}
+			switch {
+			case y+1 == h:
+				//An odd last row of pixels has nothing below it
+				if bg[0] != -2 {
+					bg = [3]int{-2}
+					b.WriteString("\x1b[49m")
+				}
+			case rgb(x, y+1) != bg:
+				bg = rgb(x, y+1)
+				fmt.Fprintf(b, "\x1b[48;2;%d;%d;%dm", bg[0], bg[1], bg[2])
+			}
+			b.WriteString("▀")
+		}
+		b.WriteString("\x1b[0m\x1b[K\n")
+	}
+	tv.lines = (h + 1) / 2
+	return b.Flush()
+}
+
+// Columns and rows of the terminal on stdout, or of the COLUMNS and LINES
+// environment variables, or 80 by 24
+func termSize() (int, int) {
+	cols, rows := ttySize()
+	if cols <= 0 || rows <= 0 {
+		cols, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+		rows, _ = strconv.Atoi(os.Getenv("LINES"))
+	}
+	if cols <= 0 || rows <= 1 {
+		return 80, 24
+	}
+	return cols, rows
+}
@@ -0,0 +1,11 @@
+// term_other.go
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package main
+
+// Size of the terminal on stdout, unknown on this platform
+func ttySize() (int, int) {
+	return 0, 0
+}
@@ -0,0 +1,125 @@
+// util.go
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bradymadden97/go-quads/quads"
+	"golang.org/x/image/colornames"
+)
+
+func openImage(filename string) (image.Image, error) {
+	if filename == stdio {
+		return decodeImage(os.Stdin)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeImage(f)
+}
+
+func decodeImage(i io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(i)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// Indexes the images below a folder or matching a glob as mosaic tiles
+func loadMosaic(tiles string, layout bool, reuse float64) (*quads.Mosaic, error) {
+	jobs, err := batchJobs([]string{tiles})
+	if err != nil {
+		return nil, err
+	}
+	m := &quads.Mosaic{Layout: layout, Reuse: reuse}
+	for _, j := range jobs {
+		img, err := openImage(j.in)
+		if err != nil {
+			return nil, fmt.Errorf("Error: mosaic tile %s: %v", j.in, err)
+		}
+		m.Add(img)
+	}
+	if m.Len() == 0 {
+		return nil, fmt.Errorf("Error: no mosaic tiles in %s", tiles)
+	}
+	return m, nil
+}
+
+// Parses a color given as R,G,B[,A], #RRGGBB[AA], a CSS color name or
+// transparent
+func decodeColor(bc string) (color.NRGBA, error) {
+	s := strings.ToLower(strings.TrimSpace(bc))
+	switch {
+	case s == "transparent":
+		return color.NRGBA{}, nil
+	case strings.HasPrefix(s, "#"):
+		b, err := hex.DecodeString(s[1:])
+		if err != nil || len(b) != 3 && len(b) != 4 {
+			return color.NRGBA{}, fmt.Errorf("Error: color %q not #RRGGBB or #RRGGBBAA", bc)
+		}
+		if len(b) == 3 {
+			b = append(b, 255)
+		}
+		return color.NRGBA{b[0], b[1], b[2], b[3]}, nil
+	case strings.Contains(s, ","):
+		l := strings.Split(s, ",")
+		if len(l) < 3 || len(l) > 4 {
+			return color.NRGBA{}, fmt.Errorf("Error: color %q has %d values, not 3 or 4", bc, len(l))
+		}
+		cl := []uint8{0, 0, 0, 255}
+		for i := range l {
+			v, err := strconv.ParseUint(strings.TrimSpace(l[i]), 10, 8)
+			if err != nil {
+				return color.NRGBA{}, fmt.Errorf("Error: color value %q in %q not between 0 and 255", l[i], bc)
+			}
+			cl[i] = uint8(v)
+		}
+		return color.NRGBA{cl[0], cl[1], cl[2], cl[3]}, nil
+	}
+	if c, ok := colornames.Map[s]; ok {
+		return color.NRGBA{c.R, c.G, c.B, c.A}, nil
+	}
+	return color.NRGBA{}, fmt.Errorf("Error: color %q not R,G,B[,A], #RRGGBB[AA], a color name or transparent", bc)
+}
+
+func stopMode(mode string) (bool, error) {
+	switch mode {
+	case "any":
+		return false, nil
+	case "all":
+		return true, nil
+	}
+	return false, fmt.Errorf("Error: stop mode %q not any or all", mode)
+}
+
+// Referenced https://github.com/esimov/stackblur-go/blob/master/cmd/main.go
+func toGIF(w io.Writer, gf *gifFrames, delay int, pause int, loop int, mode string, dither bool) error {
+	outGif := &gif.GIF{LoopCount: loop, Disposal: gf.disposal}
+	pals := gifFramePalettes(gf, mode)
+	index := map[color.RGBA]uint8{}
+	for n, i := range gf.frames {
+		//Nearest colors are kept while frames share a palette
+		if mode == "frame" {
+			index = map[color.RGBA]uint8{}
+		}
+		//Frames after the first only cover their changed area, drawn over
+		//the frames before
+		outGif.Image = append(outGif.Image, toPaletted(i, pals[n], dither, index))
+		outGif.Delay = append(outGif.Delay, delay*gf.delays[n])
+	}
+	if len(outGif.Delay) > 0 {
+		outGif.Delay[len(outGif.Delay)-1] += pause * 100
+	}
+	return gif.EncodeAll(w, outGif)
+}
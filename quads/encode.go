@@ -0,0 +1,227 @@
+// encode.go
+package quads
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	quadMagic   string = "QUAD"
+	quadVersion byte   = 1
+
+	//Largest decoded tree in pixels, so a corrupt size can not make Render
+	//allocate more than 1GB
+	maxQuadPixels = 1 << 28
+)
+
+// Encode writes the tree shape and leaf colors, quantized to bits per color
+// channel, in a compact binary format read by Decode. The layout is:
+//
+//	"QUAD", version, bits per color channel
+//	uvarint width, uvarint height
+//	uvarint length of split bits, split bits in pre-order (1 split, 0 leaf)
+//	leaf colors in pre-order as [R, G, B, A] with bits per channel each
+func (t *Tree) Encode(w io.Writer, bits int) error {
+	head := t.head
+	if bits < 1 || bits > 8 {
+		return fmt.Errorf("Error: bits per channel %d not between 1 and 8", bits)
+	}
+	splits := encodeSplits(head)
+	colors := bitWriter{}
+	max := float64(int(1)<<uint(bits) - 1)
+	for _, l := range leaves(head, nil) {
+		for c := 0; c < 4; c++ {
+			colors.write(uint(math.Round(float64(uint8(l.color[c]))*max/255)), bits)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(quadMagic)
+	bw.Write([]byte{quadVersion, byte(bits)})
+	writeUvarint(bw, uint64(head.width))
+	writeUvarint(bw, uint64(head.height))
+	writeUvarint(bw, uint64(len(splits)))
+	bw.Write(splits)
+	bw.Write(colors.buf)
+	return bw.Flush()
+}
+
+// Decode reads a tree written by Encode. Decoded trees can be rendered but
+// not split further, since they have no source image.
+func Decode(r io.Reader) (*Tree, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, len(quadMagic)+2)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr[:len(quadMagic)]) != quadMagic {
+		return nil, errors.New("Error: not a quad tree file")
+	}
+	if hdr[len(quadMagic)] != quadVersion {
+		return nil, fmt.Errorf("Error: unsupported quad tree version %d", hdr[len(quadMagic)])
+	}
+	bits := int(hdr[len(quadMagic)+1])
+	if bits < 1 || bits > 8 {
+		return nil, fmt.Errorf("Error: bits per channel %d not between 1 and 8", bits)
+	}
+
+	var dims [3]uint64
+	for i := range dims {
+		v, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		dims[i] = v
+	}
+	if dims[0] == 0 || dims[1] == 0 || dims[0] > maxQuadPixels || dims[1] > maxQuadPixels || dims[0]*dims[1] > maxQuadPixels {
+		return nil, fmt.Errorf("Error: invalid quad tree size %dx%d", dims[0], dims[1])
+	}
+	//A tree of 1px leaves has the most quads, a third more than its pixels
+	if most := (4*dims[0]*dims[1]/3 + 8) / 8; dims[2] > most {
+		return nil, fmt.Errorf("Error: %d bytes of split bits, more than a %dx%d tree has", dims[2], dims[0], dims[1])
+	}
+	buf, err := readBytes(br, dims[2])
+	if err != nil {
+		return nil, err
+	}
+
+	head := &Img{width: int(dims[0]), height: int(dims[1])}
+	head.pix = head.width * head.height
+	if err := decodeSplits(head, buf); err != nil {
+		return nil, err
+	}
+
+	ls := leaves(head, nil)
+	buf, err = readBytes(br, uint64(len(ls)*4*bits+7)/8)
+	if err != nil {
+		return nil, err
+	}
+	colors := bitReader{buf: buf}
+	max := float64(int(1)<<uint(bits) - 1)
+	for _, l := range ls {
+		l.color = make([]float64, 4)
+		for c := 0; c < 4; c++ {
+			v, err := colors.read(bits)
+			if err != nil {
+				return nil, err
+			}
+			l.color[c] = math.Round(float64(v) * 255 / max)
+		}
+	}
+	fillColors(head)
+	return &Tree{head: head, pg: newProgress(nil, head)}, nil
+}
+
+// Split bits of the quad tree in pre-order, 1 for a split quad and 0 for a leaf
+func encodeSplits(head *Img) []byte {
+	splits := bitWriter{}
+	var walk func(i *Img)
+	walk = func(i *Img) {
+		if i.c1 == nil {
+			splits.write(0, 1)
+			return
+		}
+		splits.write(1, 1)
+		for _, c := range []*Img{i.c1, i.c2, i.c3, i.c4} {
+			walk(c)
+		}
+	}
+	walk(head)
+	return splits.buf
+}
+
+// Rebuilds the children of head from split bits written by encodeSplits
+func decodeSplits(head *Img, buf []byte) error {
+	splits := bitReader{buf: buf}
+	var walk func(i *Img) error
+	walk = func(i *Img) error {
+		s, err := splits.read(1)
+		if err != nil {
+			return err
+		}
+		if s == 0 {
+			return nil
+		}
+		if i.width < 2 || i.height < 2 {
+			return errors.New("Error: quad tree splits a quad smaller than 2x2")
+		}
+		i.c1, i.c2, i.c3, i.c4 = splitRect(i)
+		for _, c := range []*Img{i.c1, i.c2, i.c3, i.c4} {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(head)
+}
+
+// Sets the color of each split quad to the area weighted average of its children
+func fillColors(i *Img) {
+	if i.c1 == nil {
+		return
+	}
+	i.color = make([]float64, 4)
+	for _, c := range []*Img{i.c1, i.c2, i.c3, i.c4} {
+		fillColors(c)
+		for j := 0; j < 4; j++ {
+			i.color[j] += c.color[j] * float64(c.pix) / float64(i.pix)
+		}
+	}
+}
+
+// Reads n bytes, growing the buffer as they arrive rather than trusting n
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(buf)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf, nil
+}
+
+func writeUvarint(w io.Writer, v uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	w.Write(b[:binary.PutUvarint(b, v)])
+}
+
+type bitWriter struct {
+	buf []byte
+	n   uint //Bits written
+}
+
+func (bw *bitWriter) write(v uint, bits int) {
+	for b := bits - 1; b >= 0; b-- {
+		if bw.n%8 == 0 {
+			bw.buf = append(bw.buf, 0)
+		}
+		if v>>uint(b)&1 == 1 {
+			bw.buf[len(bw.buf)-1] |= 0x80 >> (bw.n % 8)
+		}
+		bw.n++
+	}
+}
+
+type bitReader struct {
+	buf []byte
+	n   uint //Bits read
+}
+
+func (br *bitReader) read(bits int) (uint, error) {
+	v := uint(0)
+	for b := 0; b < bits; b++ {
+		if int(br.n/8) >= len(br.buf) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		v = v<<1 | uint(br.buf[br.n/8]>>(7-br.n%8)&1)
+		br.n++
+	}
+	return v, nil
+}
@@ -0,0 +1,98 @@
+package quads
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Image of odd size with gradients, so quads split unevenly and differ in color
+func testImage(w int, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x * y) % 251), 255})
+		}
+	}
+	return img
+}
+
+func TestEncodeDecode(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Iterations = 150
+	tr, err := New(testImage(97, 61), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tr.Encode(&buf, 8); err != nil {
+		t.Fatal(err)
+	}
+	dt, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls, dls := tr.Leaves(), dt.Leaves()
+	if len(ls) != len(dls) {
+		t.Fatalf("decoded %d leaves, want %d", len(dls), len(ls))
+	}
+	for i, l := range ls {
+		if l.Bounds() != dls[i].Bounds() {
+			t.Fatalf("leaf %d bounds %v, want %v", i, dls[i].Bounds(), l.Bounds())
+		}
+		for c := 0; c < 4; c++ {
+			if uint8(l.color[c]) != uint8(dls[i].color[c]) {
+				t.Fatalf("leaf %d color %v, want %v", i, dls[i].Color(), l.Color())
+			}
+		}
+	}
+	if !bytes.Equal(tr.Render(RenderOptions{}).Pix, dt.Render(RenderOptions{}).Pix) {
+		t.Error("decoded tree renders differently")
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	tr, err := New(testImage(9, 7), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Step()
+	var buf bytes.Buffer
+	if err := tr.Encode(&buf, 4); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	header := func(bits byte, dims ...uint64) []byte {
+		b := append([]byte(quadMagic), quadVersion, bits)
+		for _, d := range dims {
+			b = binary.AppendUvarint(b, d)
+		}
+		return b
+	}
+	tests := map[string][]byte{
+		"empty":          {},
+		"magic":          append([]byte("QUAX"), valid[4:]...),
+		"version":        append(append([]byte(quadMagic), quadVersion+1), valid[5:]...),
+		"bits":           header(9, 9, 7, 1),
+		"short header":   valid[:6],
+		"zero size":      header(4, 0, 7, 1),
+		"huge size":      header(8, 1<<31, 1<<31, 1),
+		"huge splits":    header(8, 3, 3, 1<<40),
+		"missing splits": header(8, 9, 7, 2),
+		"split 1x1":      append(header(8, 1, 1, 1), 0x80),
+		"missing colors": valid[:len(valid)-1],
+	}
+	for name, data := range tests {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: decoded without error", name)
+		}
+	}
+}
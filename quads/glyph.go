@@ -0,0 +1,288 @@
+// glyph.go
+package quads
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// DefaultRamp lists characters from least to most ink.
+const DefaultRamp = " .:-=+*#%@"
+
+// Glyphs is a ShapeRenderer drawing a character in each leaf quad, stretched
+// to the quad, in the quad's color over the background color.
+type Glyphs struct {
+	Text string //Characters drawn in turn by the position of quads in the tree, skipping whitespace, instead of by brightness
+	Ramp string //Characters from least to most ink, picked by the contrast of a quad with the background color. Empty uses DefaultRamp
+
+	font  glyphFont
+	mu    sync.Mutex
+	masks map[glyphKey][]uint8 //Kept between draws, since Draw is called with every split
+}
+
+type glyphKey struct {
+	r         rune
+	size      image.Point
+	antiAlias bool
+	samples   int
+}
+
+// Outlines of characters fitted to a quad
+type glyphFont interface {
+	mask(r rune, w int, h int, st Style) []uint8
+	svg(r rune, x float64, y float64, w float64, h float64) string //SVG path data
+}
+
+var glyphFonts = map[string]glyphFont{
+	"mono":  &vectorFont{ttf: gomono.TTF},
+	"bold":  &vectorFont{ttf: gomonobold.TTF},
+	"sans":  &vectorFont{ttf: goregular.TTF},
+	"basic": bitmapFont{basicfont.Face7x13},
+}
+
+// GlyphFonts lists the names accepted by NewGlyphs.
+func GlyphFonts() []string {
+	n := []string{}
+	for k := range glyphFonts {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// NewGlyphs returns Glyphs drawn with one of the vendored Go fonts, or the
+// basic 7x13 bitmap font.
+func NewGlyphs(font string) (*Glyphs, error) {
+	f, ok := glyphFonts[font]
+	if !ok {
+		return nil, fmt.Errorf("Error: unknown font %q, not one of %s", font, strings.Join(GlyphFonts(), ", "))
+	}
+	if vf, ok := f.(*vectorFont); ok {
+		if err := vf.load(); err != nil {
+			return nil, err
+		}
+	}
+	return &Glyphs{font: f}, nil
+}
+
+func (g *Glyphs) Draw(cv *Canvas, r image.Rectangle, c color.NRGBA, st Style) {
+	ch := g.char(cv.quad, c, st.Color)
+	w, h := r.Dx(), r.Dy()
+	cv.Fill(r, c)
+	cv.Mask(r, g.mask(ch, w, h, st), st.Color)
+	if st.Border {
+		cv.Border(r, st.Color)
+	}
+}
+
+// Character of the quad at id in the tree, with color c over the background
+// bg. Text runs through the children of each quad in order.
+func (g *Glyphs) char(id uint64, c color.NRGBA, bg color.NRGBA) rune {
+	if text := []rune(strings.Join(strings.Fields(g.Text), "")); len(text) > 0 {
+		return text[id%uint64(len(text))]
+	}
+	ramp := []rune(g.Ramp)
+	if len(ramp) == 0 {
+		ramp = []rune(DefaultRamp)
+	}
+	//A transparent background counts as black
+	d := math.Abs(luma(c) - luma(bg)*float64(bg.A)/255)
+	k := int(d / 256 * float64(len(ramp)))
+	if k >= len(ramp) {
+		k = len(ramp) - 1
+	}
+	return ramp[k]
+}
+
+// Coverage mask of ch stretched to w by h
+func (g *Glyphs) mask(ch rune, w int, h int, st Style) []uint8 {
+	k := glyphKey{ch, image.Point{w, h}, st.AntiAlias, st.Supersample}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.masks == nil {
+		g.masks = map[glyphKey][]uint8{}
+	}
+	if _, ok := g.masks[k]; !ok {
+		g.masks[k] = g.glyphFont().mask(ch, w, h, st)
+	}
+	return g.masks[k]
+}
+
+func (g *Glyphs) glyphFont() glyphFont {
+	if g.font == nil {
+		return glyphFonts["mono"]
+	}
+	return g.font
+}
+
+func (g *Glyphs) svgLeaf(id uint64, x float64, y float64, w float64, h float64, c color.NRGBA, st Style) string {
+	return fmt.Sprintf("<path d=\"%s\"", g.glyphFont().svg(g.char(id, c, st.Color), x, y, w, h))
+}
+
+func luma(c color.NRGBA) float64 {
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+// Font of vector outlines, each glyph stretched from its advance and the
+// height of the printable ASCII glyphs
+type vectorFont struct {
+	ttf  []byte
+	once sync.Once
+	err  error
+	f    *ttFont
+	top  float32 //Top of the printable ASCII glyphs above the baseline, in font units
+	bot  float32 //Bottom of the printable ASCII glyphs below the baseline, in font units
+}
+
+func (vf *vectorFont) load() error {
+	vf.once.Do(func() {
+		vf.f, vf.err = parseTTF(vf.ttf)
+		if vf.err != nil {
+			return
+		}
+		for r := rune(0x21); r < 0x7f; r++ {
+			g, err := vf.f.glyphIndex(r)
+			if err != nil {
+				vf.err = err
+				return
+			}
+			segs, err := vf.f.outline(g)
+			if err != nil {
+				vf.err = err
+				return
+			}
+			for _, s := range segs {
+				for i := 1; i < len(s.pts); i += 2 {
+					if y := s.pts[i]; y < vf.top {
+						vf.top = y
+					} else if y > vf.bot {
+						vf.bot = y
+					}
+				}
+			}
+		}
+	})
+	return vf.err
+}
+
+// Calls fn with each segment of r, its points stretched to a w by h box
+func (vf *vectorFont) segments(r rune, w float32, h float32, fn func(op byte, pts []float32)) {
+	if vf.load() != nil {
+		return
+	}
+	g, err := vf.f.glyphIndex(r)
+	if err != nil {
+		return
+	}
+	segs, err := vf.f.outline(g)
+	adv := vf.f.advance(g)
+	if err != nil || adv == 0 {
+		return
+	}
+	sx, sy := w/adv, h/(vf.bot-vf.top)
+	for _, s := range segs {
+		pts := make([]float32, len(s.pts))
+		for i := 0; i < len(pts); i += 2 {
+			pts[i], pts[i+1] = s.pts[i]*sx, (s.pts[i+1]-vf.top)*sy
+		}
+		fn(s.op, pts)
+	}
+}
+
+func (vf *vectorFont) mask(r rune, w int, h int, st Style) []uint8 {
+	path := func(z *vector.Rasterizer, w float32, h float32, px float32, st Style) {
+		started := false
+		vf.segments(r, w, h, func(op byte, p []float32) {
+			switch op {
+			case 'M':
+				if started {
+					z.ClosePath()
+				}
+				z.MoveTo(p[0], p[1])
+				started = true
+			case 'L':
+				z.LineTo(p[0], p[1])
+			case 'Q':
+				z.QuadTo(p[0], p[1], p[2], p[3])
+			}
+		})
+		if started {
+			z.ClosePath()
+		}
+	}
+	return maskShape{path: path}.mask(w, h, st)
+}
+
+func (vf *vectorFont) svg(r rune, x float64, y float64, w float64, h float64) string {
+	d := ""
+	vf.segments(r, float32(w), float32(h), func(op byte, p []float32) {
+		if op == 'M' && d != "" {
+			d += "Z "
+		}
+		d += string(op)
+		for i := 0; i < len(p); i += 2 {
+			if i > 0 {
+				d += " "
+			}
+			d += fmt.Sprintf("%.4g,%.4g", x+float64(p[i]), y+float64(p[i+1]))
+		}
+		d += " "
+	})
+	if d != "" {
+		d += "Z"
+	}
+	return d
+}
+
+// Font of pixel glyphs, each pixel stretched to cover its part of the quad
+type bitmapFont struct {
+	face *basicfont.Face
+}
+
+// Whether the pixel at x, y of r's glyph cell is set
+func (bf bitmapFont) pixel(r rune, x int, y int) bool {
+	dr, mask, mp, _, ok := bf.face.Glyph(fixed.P(0, bf.face.Ascent), r)
+	if !ok || !image.Pt(x, y).In(dr) {
+		return false
+	}
+	_, _, _, a := mask.At(mp.X+x-dr.Min.X, mp.Y+y-dr.Min.Y).RGBA()
+	return a >= 0x8000
+}
+
+func (bf bitmapFont) mask(r rune, w int, h int, st Style) []uint8 {
+	mask := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			//Sample the glyph pixel under the center of each quad pixel
+			if bf.pixel(r, (2*x+1)*bf.face.Advance/(2*w), (2*y+1)*bf.face.Height/(2*h)) {
+				mask[y*w+x] = 255
+			}
+		}
+	}
+	return mask
+}
+
+func (bf bitmapFont) svg(r rune, x float64, y float64, w float64, h float64) string {
+	sx, sy := w/float64(bf.face.Advance), h/float64(bf.face.Height)
+	d := []string{}
+	for py := 0; py < bf.face.Height; py++ {
+		for px := 0; px < bf.face.Advance; px++ {
+			if bf.pixel(r, px, py) {
+				d = append(d, fmt.Sprintf("M%.4g,%.4g h%.4g v%.4g h%.4g Z", x+float64(px)*sx, y+float64(py)*sy, sx, sy, -sx))
+			}
+		}
+	}
+	return strings.Join(d, " ")
+}
@@ -0,0 +1,8 @@
+module github.com/bradymadden97/go-quads/quads
+
+go 1.22
+
+require (
+	github.com/disintegration/imaging v1.2.1
+	golang.org/x/image v0.0.0-20171013013600-f7e31b4ea2e3
+)
@@ -1,19 +1,50 @@
 // heap.go
-package main
+package quads
 
-type MinHeap []*Img
+import (
+	"container/heap"
+	"math"
+)
 
-func (mh MinHeap) Len() int { return len(mh) }
+type splitPriority struct {
+	area  float64 //Exponent applied to quad area
+	depth float64 //Multiplier applied once per level of depth
+	min   int     //Minimum width and height of a quad after splitting
+}
+
+func (pr splitPriority) score(i *Img) float64 {
+	return i.error / float64(i.pix) * math.Pow(float64(i.pix), pr.area) * math.Pow(pr.depth, float64(i.depth))
+}
+
+func (pr splitPriority) splittable(i *Img) bool {
+	min := pr.min
+	if min < 1 {
+		min = 1
+	}
+	return i.width/2 >= min && i.height/2 >= min
+}
+
+func pushNode(mh *minHeap, pr splitPriority, i *Img) {
+	if !pr.splittable(i) {
+		return
+	}
+	i.priority = pr.score(i)
+	heap.Push(mh, i)
+}
+
+type minHeap []*Img
+
+func (mh minHeap) Len() int { return len(mh) }
 
-func (mh MinHeap) Less(i, j int) bool {
-	return mh[i].error > mh[j].error
+func (mh minHeap) Less(i, j int) bool {
+	return mh[i].priority > mh[j].priority
 }
 
-func (mh MinHeap) Swap(i, j int) {
+func (mh minHeap) Swap(i, j int) {
 	mh[i], mh[j] = mh[j], mh[i]
 }
 
-func (mh *MinHeap) Pop() interface{} {
+func (mh *minHeap) Pop() interface{} {
 	old := *mh
 	n := len(old)
 	img := old[n-1]
@@ -21,7 +52,7 @@ func (mh *MinHeap) Pop() interface{} {
 	return img
 }
 
-func (mh *MinHeap) Push(x interface{}) {
+func (mh *minHeap) Push(x interface{}) {
 	img := x.(*Img)
 	*mh = append(*mh, img)
 }
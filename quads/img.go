@@ -0,0 +1,90 @@
+// img.go
+package quads
+
+import (
+	"image"
+	"image/color"
+)
+
+// Img is a quad of the tree, covering a rectangle of the source image.
+type Img struct {
+	pix      int         //Number of pixels in image
+	color    []float64   //Average color stored as [R, G, B, A]
+	error    float64     //Calculated error between average pixels and image
+	depth    int         //Depth of image in quad tree
+	priority float64     //Split priority derived from error, area and depth
+	width    int         //Picture width
+	height   int         //Picture height
+	point    image.Point //Upper-left point of image
+	id       uint64      //Position in the tree, 4*id+k+1 for child k. Picks the characters of Glyphs Text
+	c1       *Img        //Pointer to child 1
+	c2       *Img        //Pointer to child 2
+	c3       *Img        //Pointer to child 3
+	c4       *Img        //Pointer to child 4
+}
+
+// Bounds returns the rectangle of the image covered by the quad.
+func (i *Img) Bounds() image.Rectangle {
+	return image.Rect(i.point.X, i.point.Y, i.point.X+i.width, i.point.Y+i.height)
+}
+
+// Color returns the average color of the quad.
+func (i *Img) Color() color.NRGBA {
+	return color.NRGBA{uint8(i.color[0]), uint8(i.color[1]), uint8(i.color[2]), uint8(i.color[3])}
+}
+
+// Error returns the error between the quad's average color and its pixels.
+func (i *Img) Error() float64 {
+	return i.error
+}
+
+// Depth returns the depth of the quad in the tree, 0 for the root.
+func (i *Img) Depth() int {
+	return i.depth
+}
+
+// Children returns the four children of a split quad, or nil for a leaf.
+func (i *Img) Children() []*Img {
+	if i.c1 == nil {
+		return nil
+	}
+	return []*Img{i.c1, i.c2, i.c3, i.c4}
+}
+
+func leaves(i *Img, l []*Img) []*Img {
+	if i.c1 == nil {
+		return append(l, i)
+	}
+	for _, c := range []*Img{i.c1, i.c2, i.c3, i.c4} {
+		l = leaves(c, l)
+	}
+	return l
+}
+
+func cloneTree(i *Img) *Img {
+	c := *i
+	if i.c1 != nil {
+		c.c1, c.c2, c.c3, c.c4 = cloneTree(i.c1), cloneTree(i.c2), cloneTree(i.c3), cloneTree(i.c4)
+	}
+	return &c
+}
+
+// Scales the quad tree in place so the head covers w x h pixels
+func scaleTree(head *Img, w int, h int) {
+	ow, oh := head.width, head.height
+	var walk func(i *Img)
+	walk = func(i *Img) {
+		scaleRect(i, ow, oh, w, h)
+		for _, c := range i.Children() {
+			walk(c)
+		}
+	}
+	walk(head)
+}
+
+func scaleRect(i *Img, ow int, oh int, w int, h int) {
+	x0, y0 := i.point.X*w/ow, i.point.Y*h/oh
+	x1, y1 := (i.point.X+i.width)*w/ow, (i.point.Y+i.height)*h/oh
+	i.point, i.width, i.height = image.Point{x0, y0}, x1-x0, y1-y0
+	i.pix = i.width * i.height
+}
@@ -0,0 +1,81 @@
+// integral.go
+package quads
+
+import (
+	"image"
+	"sync"
+)
+
+type integral struct {
+	width   int          //Picture width
+	height  int          //Picture height
+	sum     [4][]int64   //Summed-area tables of [R, G, B, A]
+	sq      [3][]int64   //Summed-area tables of squared [R, G, B]
+	img     *image.NRGBA //Source image for per-pixel metrics
+	lab     []float64    //Source image converted to [L, a, b]
+	labOnce sync.Once
+}
+
+func newIntegral(img *image.NRGBA) *integral {
+	w := img.Bounds().Max.X
+	h := img.Bounds().Max.Y
+	in := integral{width: w, height: h, img: img}
+	for c := 0; c < 4; c++ {
+		in.sum[c] = make([]int64, (w+1)*(h+1))
+	}
+	for c := 0; c < 3; c++ {
+		in.sq[c] = make([]int64, (w+1)*(h+1))
+	}
+
+	row := make([]int64, 7)
+	for y := 0; y < h; y++ {
+		for c := range row {
+			row[c] = 0
+		}
+		for x := 0; x < w; x++ {
+			loc := y*img.Stride + x*4
+			above, cur := y*(w+1)+x+1, (y+1)*(w+1)+x+1
+			for c := 0; c < 4; c++ {
+				v := int64(img.Pix[loc+c])
+				row[c] += v
+				in.sum[c][cur] = in.sum[c][above] + row[c]
+				if c < 3 {
+					row[c+4] += v * v
+					in.sq[c][cur] = in.sq[c][above] + row[c+4]
+				}
+			}
+		}
+	}
+	return &in
+}
+
+func (in *integral) rect(t []int64, p image.Point, w int, h int) int64 {
+	s := in.width + 1
+	x0, y0, x1, y1 := p.X, p.Y, p.X+w, p.Y+h
+	return t[y1*s+x1] - t[y0*s+x1] - t[y1*s+x0] + t[y0*s+x0]
+}
+
+func (in *integral) sums(p image.Point, w int, h int) ([]float64, []float64) {
+	sum, sq := make([]float64, 4), make([]float64, 3)
+	for c := 0; c < 4; c++ {
+		sum[c] = float64(in.rect(in.sum[c], p, w, h))
+	}
+	for c := 0; c < 3; c++ {
+		sq[c] = float64(in.rect(in.sq[c], p, w, h))
+	}
+	return sum, sq
+}
+
+func (in *integral) labPixels() []float64 {
+	in.labOnce.Do(func() {
+		in.lab = make([]float64, in.width*in.height*3)
+		for y := 0; y < in.height; y++ {
+			for x := 0; x < in.width; x++ {
+				loc, p := y*in.img.Stride+x*4, (y*in.width+x)*3
+				r, g, b := float64(in.img.Pix[loc]), float64(in.img.Pix[loc+1]), float64(in.img.Pix[loc+2])
+				in.lab[p], in.lab[p+1], in.lab[p+2] = toLab(r, g, b)
+			}
+		}
+	})
+	return in.lab
+}
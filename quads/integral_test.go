@@ -0,0 +1,80 @@
+package quads
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestIntegral(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []image.Point{{1, 1}, {7, 3}, {13, 29}, {37, 21}} {
+		img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+		for i := range img.Pix {
+			img.Pix[i] = uint8(rnd.Intn(256))
+		}
+		in := newIntegral(img)
+
+		//Every quad down to 1px, through uneven splits of odd sizes
+		var check func(q *Img)
+		check = func(q *Img) {
+			var sum, sq [4]float64
+			for y := q.point.Y; y < q.point.Y+q.height; y++ {
+				for x := q.point.X; x < q.point.X+q.width; x++ {
+					c := img.NRGBAAt(x, y)
+					for ch, v := range []uint8{c.R, c.G, c.B, c.A} {
+						sum[ch] += float64(v)
+						sq[ch] += float64(v) * float64(v)
+					}
+				}
+			}
+			gs, gq := in.sums(q.point, q.width, q.height)
+			for ch := 0; ch < 4; ch++ {
+				if gs[ch] != sum[ch] || ch < 3 && gq[ch] != sq[ch] {
+					t.Fatalf("%v of %v channel %d: sums %v %v, want %v %v", q.Bounds(), size, ch, gs[ch], gq, sum[ch], sq)
+				}
+			}
+
+			avg := averageRGB(gs, q.pix)
+			e := 0.0
+			for y := q.point.Y; y < q.point.Y+q.height; y++ {
+				for x := q.point.X; x < q.point.X+q.width; x++ {
+					c := img.NRGBAAt(x, y)
+					for ch, v := range []uint8{c.R, c.G, c.B} {
+						e += math.Pow(float64(v)-avg[ch], 2)
+					}
+				}
+			}
+			if got := calculateError(gs, gq, q.pix); math.Abs(got-e) > 1e-6*math.Max(e, 1) {
+				t.Fatalf("%v of %v: error %v, want %v", q.Bounds(), size, got, e)
+			}
+
+			if q.width < 2 && q.height < 2 {
+				return
+			}
+			c1, c2, c3, c4 := splitRect(q)
+			for _, c := range []*Img{c1, c2, c3, c4} {
+				if c.pix > 0 {
+					check(c)
+				}
+			}
+		}
+		check(&Img{width: size.X, height: size.Y, pix: size.X * size.Y})
+	}
+}
+
+func TestIntegralRect(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for x := 0; x < 5; x++ {
+		img.SetNRGBA(x, 1, color.NRGBA{uint8(x), 10, 20, 255})
+	}
+	in := newIntegral(img)
+	if got := in.rect(in.sum[0], image.Point{1, 1}, 3, 2); got != 1+2+3 {
+		t.Errorf("red of 3x2 at 1,1 is %d, want 6", got)
+	}
+	if got := in.rect(in.sq[1], image.Point{0, 0}, 5, 3); got != 5*100 {
+		t.Errorf("squared green of the image is %d, want 500", got)
+	}
+}
@@ -0,0 +1,69 @@
+// mask.go
+package quads
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/vector"
+)
+
+// Coverage of a shape filling a w by h quad, one byte per pixel in rows
+type maskFunc func(w int, h int) []uint8
+
+// Pixels fully inside or outside the ellipse by distance from the center
+// pixel, without anti-aliasing
+func hardEllipse(w int, h int) []uint8 {
+	mask := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			//A 1px wide or tall quad has no outside
+			if w/2 == 0 || h/2 == 0 || euclideanDistance(w/2, x, h/2, y) < ovalRadius(w/2, h/2, getAngle(w, h, x, y)) {
+				mask[y*w+x] = 255
+			}
+		}
+	}
+	return mask
+}
+
+// Exact coverage of path from the vector rasterizer, at n times the quad size
+func pathMask(path func(z *vector.Rasterizer, w float32, h float32, px float32, st Style), w int, h int, n int, st Style) []uint8 {
+	z := vector.NewRasterizer(w*n, h*n)
+	path(z, float32(w*n), float32(h*n), float32(n), st)
+	mask := image.NewAlpha(z.Bounds())
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return mask.Pix
+}
+
+// Coverage of path from n by n samples per pixel, each inside or outside
+func sampledMask(path func(z *vector.Rasterizer, w float32, h float32, px float32, st Style), w int, h int, n int, st Style) []uint8 {
+	hi, mask := pathMask(path, w, h, n, st), make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			in := 0
+			for sy := 0; sy < n; sy++ {
+				for sx := 0; sx < n; sx++ {
+					if hi[(y*n+sy)*w*n+x*n+sx] >= 128 {
+						in++
+					}
+				}
+			}
+			mask[y*w+x] = uint8(math.Round(float64(in) * 255 / float64(n*n)))
+		}
+	}
+	return mask
+}
+
+// Mixes the shape pixel in into the outside pixel p by coverage cov
+func mix(p []uint8, in []uint8, cov uint8) {
+	ai, ao := int(in[3])*int(cov), int(p[3])*(255-int(cov))
+	a := ai + ao
+	if a == 0 {
+		copy(p, []uint8{0, 0, 0, 0})
+		return
+	}
+	for k := 0; k < 3; k++ {
+		p[k] = uint8((int(in[k])*ai + int(p[k])*ao) / a)
+	}
+	p[3] = uint8(a / 255)
+}
@@ -0,0 +1,115 @@
+// metric.go
+package quads
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Measures how far the pixels of a node are from its average color.
+// The average is already stored in i.color when Error is called.
+type errorMetric interface {
+	Error(in *integral, i *Img) float64
+}
+
+var metrics = map[string]errorMetric{
+	"mse":   mseMetric{},
+	"mae":   maeMetric{},
+	"luma":  lumaMetric{},
+	"lab":   labMetric{},
+	"alpha": alphaMetric{},
+}
+
+func metricByName(name string) (errorMetric, error) {
+	m, ok := metrics[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Error: unknown error metric %q, expected one of %s", name, strings.Join(Metrics(), ", "))
+	}
+	return m, nil
+}
+
+// Metrics returns the names of the built-in error metrics.
+func Metrics() []string {
+	names := make([]string, 0, len(metrics))
+	for n := range metrics {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sum of squared RGB differences
+type mseMetric struct{}
+
+func (mseMetric) Error(in *integral, i *Img) float64 {
+	sum, sq := in.sums(i.point, i.width, i.height)
+	return calculateError(sum, sq, i.pix)
+}
+
+// Sum of absolute RGB differences
+type maeMetric struct{}
+
+func (maeMetric) Error(in *integral, i *Img) float64 {
+	e := 0.0
+	for y := i.point.Y; y < i.point.Y+i.height; y++ {
+		for x := i.point.X; x < i.point.X+i.width; x++ {
+			loc := y*in.img.Stride + x*4
+			for c := 0; c < 3; c++ {
+				e += math.Abs(float64(in.img.Pix[loc+c]) - i.color[c])
+			}
+		}
+	}
+	return e
+}
+
+// Sum of squared RGB differences weighted by each channel's share of luminance
+type lumaMetric struct{}
+
+var lumaWeights = []float64{0.299, 0.587, 0.114}
+
+func (lumaMetric) Error(in *integral, i *Img) float64 {
+	sum, sq := in.sums(i.point, i.width, i.height)
+	pix := float64(i.pix)
+	e := 0.0
+	for c := 0; c < 3; c++ {
+		e += lumaWeights[c] * (sq[c] - sum[c]*sum[c]/pix)
+	}
+	return math.Max(e*3, 0)
+}
+
+// Sum of CIE76 color differences in CIELAB space
+type labMetric struct{}
+
+func (labMetric) Error(in *integral, i *Img) float64 {
+	lab := in.labPixels()
+	l0, a0, b0 := toLab(i.color[0], i.color[1], i.color[2])
+	e := 0.0
+	for y := i.point.Y; y < i.point.Y+i.height; y++ {
+		for x := i.point.X; x < i.point.X+i.width; x++ {
+			loc := (y*in.width + x) * 3
+			e += math.Sqrt(math.Pow(lab[loc]-l0, 2) + math.Pow(lab[loc+1]-a0, 2) + math.Pow(lab[loc+2]-b0, 2))
+		}
+	}
+	return e
+}
+
+// Sum of squared differences of alpha premultiplied RGB plus alpha
+type alphaMetric struct{}
+
+func (alphaMetric) Error(in *integral, i *Img) float64 {
+	oa := i.color[3] / 255
+	e := 0.0
+	for y := i.point.Y; y < i.point.Y+i.height; y++ {
+		for x := i.point.X; x < i.point.X+i.width; x++ {
+			loc := y*in.img.Stride + x*4
+			a := float64(in.img.Pix[loc+3]) / 255
+			for c := 0; c < 3; c++ {
+				e += math.Pow(float64(in.img.Pix[loc+c])*a-i.color[c]*oa, 2)
+			}
+			e += math.Pow(float64(in.img.Pix[loc+3])-i.color[3], 2)
+		}
+	}
+	return e
+}
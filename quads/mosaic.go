@@ -0,0 +1,150 @@
+// mosaic.go
+package quads
+
+import (
+	"container/list"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+// Largest width and height tiles are kept at, so a library of photos fits in
+// memory
+const tileSize = 256
+
+// Bytes of resized tiles kept, the least recently drawn are dropped past it
+const sizedTileBytes = 64 << 20
+
+// Mosaic is a ShapeRenderer filling each leaf quad with the tile image whose
+// colors match the quad best. Tiles are resized to cover the quad and cropped
+// to its center. Without tiles it draws rects.
+type Mosaic struct {
+	Layout bool    //Match the average colors of the 2x2 quarters of tiles and quads, instead of the whole
+	Reuse  float64 //Color distance added to a tile's match for every time it was already drawn
+
+	tiles []*tile
+	mu    sync.Mutex
+	sized map[tileKey]*list.Element //Tiles resized to quad sizes, kept between draws
+	lru   list.List                 //Resized tiles, most recently drawn first
+	bytes int                       //Pixel bytes of resized tiles
+}
+
+type tile struct {
+	img      *image.NRGBA  //Tile scaled to fit tileSize
+	avg      [3]float64    //Average [R, G, B]
+	quarters [4][3]float64 //Average [R, G, B] of the top left, top right, bottom left and bottom right quarters
+}
+
+type tileKey struct {
+	t    *tile
+	size image.Point
+}
+
+type sizedTile struct {
+	k   tileKey
+	img *image.NRGBA
+}
+
+// Mosaic tiles drawn on an image, so Draw counts a split quad's tile as given
+// back when its children are drawn
+type tileUses struct {
+	img   *image.NRGBA
+	count map[*tile]int    //Leaves each tile is drawn in
+	quads map[uint64]*tile //Tile drawn in each leaf, by the position of the quad in the tree
+}
+
+// Add indexes img as a tile by its average colors.
+func (m *Mosaic) Add(img image.Image) {
+	t := &tile{img: imaging.Fit(img, tileSize, tileSize, imaging.Lanczos)}
+	if t.img.Bounds().Empty() {
+		return
+	}
+	t.avg = rgb(imaging.Resize(t.img, 1, 1, imaging.Box).NRGBAAt(0, 0))
+	q := imaging.Resize(t.img, 2, 2, imaging.Box)
+	for k := range t.quarters {
+		t.quarters[k] = rgb(q.NRGBAAt(k%2, k/2))
+	}
+	m.tiles = append(m.tiles, t)
+}
+
+// Len returns the number of tiles.
+func (m *Mosaic) Len() int {
+	return len(m.tiles)
+}
+
+func (m *Mosaic) Draw(cv *Canvas, r image.Rectangle, c color.NRGBA, st Style) {
+	u := cv.uses
+	//The quad replaces the one it was split from, if that was drawn
+	if p := (cv.quad - 1) / 4; cv.quad > 0 && u.quads[p] != nil {
+		u.count[u.quads[p]]--
+		delete(u.quads, p)
+	}
+	if t := m.match(cv, r, c); t != nil {
+		cv.Paste(r, m.resized(t, r.Dx(), r.Dy()))
+		u.count[t]++
+		u.quads[cv.quad] = t
+	} else {
+		cv.Fill(r, c)
+	}
+	if st.Border {
+		cv.Border(r, st.Color)
+	}
+}
+
+// Tile closest to the colors of the quad covering r, with reuse counted on cv
+func (m *Mosaic) match(cv *Canvas, r image.Rectangle, c color.NRGBA) *tile {
+	qs, layout := cv.Quarters(r)
+	layout = layout && m.Layout
+	var best *tile
+	bd := math.Inf(1)
+	for _, t := range m.tiles {
+		d := 0.0
+		if layout {
+			for k, q := range qs {
+				d += rgbDistance(t.quarters[k], rgb(q)) / 4
+			}
+		} else {
+			d = rgbDistance(t.avg, rgb(c))
+		}
+		d += m.Reuse * float64(cv.uses.count[t])
+		if d < bd {
+			best, bd = t, d
+		}
+	}
+	return best
+}
+
+// Tile t resized to cover w by h, kept for other quads of that size until
+// sizedTileBytes of more recently drawn tiles push it out
+func (m *Mosaic) resized(t *tile, w int, h int) *image.NRGBA {
+	k := tileKey{t, image.Point{w, h}}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sized == nil {
+		m.sized = map[tileKey]*list.Element{}
+	}
+	if e, ok := m.sized[k]; ok {
+		m.lru.MoveToFront(e)
+		return e.Value.(sizedTile).img
+	}
+	img := imaging.Fill(t.img, w, h, imaging.Center, imaging.Lanczos)
+	m.sized[k] = m.lru.PushFront(sizedTile{k, img})
+	m.bytes += len(img.Pix)
+	for m.bytes > sizedTileBytes && m.lru.Len() > 1 {
+		s := m.lru.Remove(m.lru.Back()).(sizedTile)
+		delete(m.sized, s.k)
+		m.bytes -= len(s.img.Pix)
+	}
+	return img
+}
+
+func rgb(c color.NRGBA) [3]float64 {
+	return [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+}
+
+func rgbDistance(a [3]float64, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
@@ -0,0 +1,121 @@
+// options.go
+package quads
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"time"
+)
+
+// Options controls how a Tree picks quads to split and when Run stops.
+type Options struct {
+	Metric       string  //Error metric, one of Metrics()
+	AreaPower    float64 //Split priority is mean error * area^AreaPower
+	DepthPenalty float64 //Split priority multiplier per level of depth
+	MinSize      int     //Minimum width and height of a quad after splitting
+	Crop         bool    //Crop the image to power of two dimensions
+	Batch        int     //Quads split per round of Run, 0 splits one at a time
+	Workers      int     //Goroutines splitting a round, 0 uses every CPU
+
+	Iterations  int           //Stop after this many splits, 0 for no limit
+	TargetError float64       //Stop once total error drops to this value
+	TargetPSNR  float64       //Stop once PSNR in dB reaches this value
+	MaxLeaves   int           //Stop once this many leaf quads exist
+	MaxDepth    int           //Stop once a quad reaches this depth
+	MinLeafSize int           //Stop once a quad's width or height drops to this size
+	Timeout     time.Duration //Stop once Run has taken this long
+	StopAll     bool          //Stop once all criteria are met instead of any
+}
+
+// DefaultOptions returns the options used by the quads command.
+func DefaultOptions() Options {
+	return Options{
+		Metric:       "mse",
+		AreaPower:    1,
+		DepthPenalty: 1,
+		MinSize:      1,
+		Iterations:   200,
+	}
+}
+
+func (o Options) priority() splitPriority {
+	pr := splitPriority{area: o.AreaPower, depth: o.DepthPenalty, min: o.MinSize}
+	if pr.depth <= 0 {
+		pr.depth = 1
+	}
+	return pr
+}
+
+func (o Options) workers() int {
+	if o.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Workers
+}
+
+func (o Options) stop() stopCriteria {
+	return stopCriteria{
+		itr:    o.Iterations,
+		err:    o.TargetError,
+		psnr:   o.TargetPSNR,
+		leaves: o.MaxLeaves,
+		depth:  o.MaxDepth,
+		size:   o.MinLeafSize,
+		time:   o.Timeout,
+		all:    o.StopAll,
+	}
+}
+
+// Most samples per pixel side of RenderOptions.Supersample, larger values
+// are drawn with this many. Masks are rasterized at n times the quad size.
+const MaxSupersample int = 16
+
+// RenderOptions controls how a Tree is drawn.
+type RenderOptions struct {
+	Border bool        //Add a 1px border to quads
+	Circle bool        //Modify quads to circles, same as the ellipse Shape
+	Color  color.NRGBA //Border/ background color
+	Width  int         //Output width, 0 keeps the tree's aspect ratio
+	Height int         //Output height, 0 keeps the tree's aspect ratio
+
+	Shape       ShapeRenderer //Shape drawn for each leaf quad, nil for rects or Circle
+	Radius      float64       //Corner radius of rounded rects in pixels
+	AntiAlias   bool          //Blend shape edges by their exact pixel coverage
+	Supersample int           //Blend shape edges by n by n samples per pixel instead, when above 1, at most MaxSupersample
+
+	//Image the quads are composited over, scaled and cropped to cover the
+	//output. Shows through a transparent Color and translucent quads.
+	Background image.Image
+}
+
+func (ro RenderOptions) size(w int, h int) (int, int) {
+	switch {
+	case ro.Width <= 0 && ro.Height <= 0:
+		return w, h
+	case ro.Width <= 0:
+		return w * ro.Height / h, ro.Height
+	case ro.Height <= 0:
+		return ro.Width, h * ro.Width / w
+	}
+	return ro.Width, ro.Height
+}
+
+func (ro RenderOptions) colorlist() []uint8 {
+	return []uint8{ro.Color.R, ro.Color.G, ro.Color.B, ro.Color.A}
+}
+
+// Shape of leaf quads, Circle picks ellipses without a Shape
+func (ro RenderOptions) shape() ShapeRenderer {
+	switch {
+	case ro.Shape != nil:
+		return ro.Shape
+	case ro.Circle:
+		return shapes["ellipse"]
+	}
+	return shapes["rect"]
+}
+
+func (ro RenderOptions) style() Style {
+	return Style{Color: ro.Color, Border: ro.Border, AntiAlias: ro.AntiAlias, Supersample: min(ro.Supersample, MaxSupersample), Radius: ro.Radius}
+}
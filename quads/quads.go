@@ -1,222 +1,358 @@
 // quads.go
-package main
+
+// Package quads builds pixel art from images using quad trees.
+// Inspired by https://github.com/fogleman/Quads.
+package quads
 
 import (
-	"bytes"
 	"container/heap"
+	"context"
+	"errors"
 	"image"
 	"image/color"
 	"math"
-	"strconv"
+	"sync"
 
 	"github.com/disintegration/imaging"
 )
 
-func initialize(fn string) (*Img, error) {
-	img, err := openImage(fn)
+// Tree is a quad tree over an image, refined one split at a time.
+type Tree struct {
+	head   *Img
+	in     *integral //Source image statistics, nil for decoded trees
+	metric errorMetric
+	opts   Options
+	pr     splitPriority
+	st     stopCriteria
+	mh     minHeap
+	pg     *progress
+
+	bgMu  sync.Mutex
+	bgSrc image.Image  //RenderOptions.Background that bg was scaled from
+	bg    *image.NRGBA //Background scaled to the last rendered size
+
+	usesMu sync.Mutex
+	uses   *tileUses //Mosaic tiles drawn on the last image rendered, counted on by Draw
+}
+
+// Stats describes the current state of a Tree.
+type Stats struct {
+	Iterations int     //Splits performed
+	Leaves     int     //Number of leaf quads
+	Depth      int     //Deepest leaf quad
+	MinSize    int     //Smallest width or height of a leaf quad
+	Error      float64 //Total error of leaf quads
+	PSNR       float64 //PSNR of the rendered tree in dB, 0 without a source image
+}
+
+// Split describes a quad split by Run.
+type Split struct {
+	Parent    *Img    //Quad that was split
+	Children  [4]*Img //New quads covering Parent
+	Error     float64 //Total error of leaf quads after the split
+	Iteration int     //Splits performed, including this one
+}
+
+// Observer is called by Run after each split.
+type Observer func(sp Split) error
+
+// New creates a Tree with a single quad covering img.
+func New(img image.Image, opts Options) (*Tree, error) {
+	src, err := toNRGBA(img)
 	if err != nil {
 		return nil, err
 	}
-	headNode := Img{
-		width:  img.Bounds().Max.X,
-		height: img.Bounds().Max.Y,
-		point:  image.Point{0, 0},
+	if opts.Crop {
+		src = cropImage(src)
 	}
-	headNode.hist, headNode.pix = histogram(img)
-	headNode.color, headNode.error = analyzeImage(&headNode)
-	return &headNode, nil
-}
-
-func iterate(mh *MinHeap, hn *Img, itr int, fn string, b bool, c bool, bc string, s bool, g bool) ([]image.Image, error) {
-	//imgs := make([]image.Image, itr)
-	cl, err := decodeColor(bc)
+	if src.Bounds().Empty() {
+		return nil, errors.New("Error: image has no pixels")
+	}
+	if opts.Metric == "" {
+		opts.Metric = "mse"
+	}
+	m, err := metricByName(opts.Metric)
 	if err != nil {
 		return nil, err
 	}
-	past_img := createImage(hn, b, c, cl)
 
-	for i := 0; i < itr; i++ {
-		if s {
-			err := saveImage(past_img, fn, i, itr)
-			if err != nil {
-				return nil, err
-			}
-		}
+	in := newIntegral(src)
+	t := &Tree{
+		head:   newNode(in, m, src.Bounds().Max.X, src.Bounds().Max.Y, image.Point{0, 0}),
+		in:     in,
+		metric: m,
+		opts:   opts,
+		pr:     opts.priority(),
+		st:     opts.stop(),
+	}
+	pushNode(&t.mh, t.pr, t.head)
+	t.pg = newProgress(in, t.head)
+	return t, nil
+}
 
-		a := heap.Pop(mh).(*Img)
-		if a.width <= 1 || a.height <= 1 {
-			heap.Push(mh, a)
-			break
-		}
-		a.c1, a.c2, a.c3, a.c4 = splitHistogram(a.hist, a.width, a.height, a.point)
+// Root returns the quad covering the whole image.
+func (t *Tree) Root() *Img {
+	return t.head
+}
 
-		heap.Push(mh, a.c1)
-		heap.Push(mh, a.c2)
-		heap.Push(mh, a.c3)
-		heap.Push(mh, a.c4)
+// Options returns the options the tree was created with.
+func (t *Tree) Options() Options {
+	return t.opts
+}
+
+// Leaves returns the unsplit quads in pre-order.
+func (t *Tree) Leaves() []*Img {
+	return leaves(t.head, nil)
+}
 
-		past_img = updateImage(past_img, []*Img{a.c1, a.c2, a.c3, a.c4}, b, c, cl)
+// Stats returns the current iteration count, leaf count and error.
+func (t *Tree) Stats() Stats {
+	s := Stats{
+		Iterations: t.pg.itr,
+		Leaves:     t.pg.leaves,
+		Depth:      t.pg.depth,
+		MinSize:    t.pg.size,
+		Error:      t.pg.err,
 	}
-	err = saveImage(past_img, fn, itr, itr)
-	if err != nil {
-		return nil, err
+	if t.in != nil {
+		s.PSNR = t.pg.psnr()
 	}
-	return nil, nil
+	return s
 }
 
-func histogram(img *image.NRGBA) ([][]int, int) {
-	w := img.Bounds().Max.X
-	h := img.Bounds().Max.Y
-	p := w * h
-	hist := make([][]int, p)
-
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			loc := y*img.Stride + x*4
+// Done reports whether the stop criteria are met or no quad can be split.
+func (t *Tree) Done() bool {
+	return t.in == nil || t.mh.Len() == 0 || t.st.done(t.pg)
+}
 
-			r := int(img.Pix[loc])
-			g := int(img.Pix[loc+1])
-			b := int(img.Pix[loc+2])
-			o := int(img.Pix[loc+3])
+// Step splits the highest priority quad and returns it, or nil if no quad
+// can be split. Step ignores the stop criteria.
+func (t *Tree) Step() *Img {
+	sps := t.split(1)
+	if len(sps) == 0 {
+		return nil
+	}
+	return sps[0].Parent
+}
 
-			i := []int{r, g, b, o}
-			hist[y*w+x] = i
+// Run splits quads until the stop criteria are met, no quad can be split or
+// ctx is done, calling each observer after every split. Run returns ctx's
+// error, or the first error returned by an observer. The Timeout option is
+// measured from the start of Run.
+//
+// With the Batch option Run splits that many of the highest priority quads
+// per round, computing their children on Workers goroutines. The result
+// depends on Batch but not on Workers.
+func (t *Tree) Run(ctx context.Context, obs ...Observer) error {
+	t.pg.restart()
+	for !t.Done() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		k := t.opts.Batch
+		if k < 1 {
+			k = 1
+		}
+		if rem := t.st.itr - t.pg.itr; t.st.itr > 0 && rem > 0 && rem < k {
+			k = rem
+		}
+		for _, sp := range t.split(k) {
+			for _, o := range obs {
+				if err := o(sp); err != nil {
+					return err
+				}
+			}
 		}
 	}
-	return hist, p
+	return nil
 }
 
-func analyzeImage(i *Img) ([]float64, float64) {
-	avg := averageRGB(i.hist, i.pix)
-	err := calculateError(i.hist, avg)
-	return avg, err
+// Pops up to k quads in priority order, computes their children concurrently
+// and then pushes the children and updates progress in pop order. Once the
+// stop criteria are met the rest of the quads are pushed back unsplit, so a
+// round does not split past them.
+func (t *Tree) split(k int) []Split {
+	if t.in == nil {
+		return nil
+	}
+	if k > t.mh.Len() {
+		k = t.mh.Len()
+	}
+	as := make([]*Img, 0, k)
+	for len(as) < k {
+		as = append(as, heap.Pop(&t.mh).(*Img))
+	}
+	parallel(len(as), t.opts.workers(), func(i int) {
+		a := as[i]
+		a.c1, a.c2, a.c3, a.c4 = splitNode(t.in, t.metric, a)
+	})
+
+	sps := make([]Split, 0, len(as))
+	for i, a := range as {
+		if i > 0 && t.st.done(t.pg) {
+			for _, b := range as[i:] {
+				b.c1, b.c2, b.c3, b.c4 = nil, nil, nil, nil
+				heap.Push(&t.mh, b)
+			}
+			break
+		}
+		for _, c := range []*Img{a.c1, a.c2, a.c3, a.c4} {
+			pushNode(&t.mh, t.pr, c)
+		}
+		t.pg.update(t.in, a)
+		sps = append(sps, Split{
+			Parent:    a,
+			Children:  [4]*Img{a.c1, a.c2, a.c3, a.c4},
+			Error:     t.pg.err,
+			Iteration: t.pg.itr,
+		})
+	}
+	return sps
 }
 
-func averageRGB(hist [][]int, p int) []float64 {
-	r, g, b, o := 0, 0, 0, 0
-	for i := 0; i < p; i++ {
-		r += hist[i][0]
-		g += hist[i][1]
-		b += hist[i][2]
-		o += hist[i][3]
+// Calls fn for 0 <= i < n on up to workers goroutines
+func parallel(n int, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
 	}
-	pix := float64(p)
-	avg := []float64{float64(r) / pix, float64(g) / pix, float64(b) / pix, float64(o) / pix}
-	return avg
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
 }
 
-func calculateError(hist [][]int, avg []float64) float64 {
-	re, ge, be := 0.0, 0.0, 0.0
-	ravg, gavg, bavg := avg[0], avg[1], avg[2]
-	for i := 0; i < len(hist); i++ {
-		re += math.Pow(float64(hist[i][0])-ravg, 2)
-		ge += math.Pow(float64(hist[i][1])-gavg, 2)
-		be += math.Pow(float64(hist[i][2])-bavg, 2)
+// Render draws the leaf quads of the tree.
+func (t *Tree) Render(ro RenderOptions) *image.NRGBA {
+	head := t.head
+	if w, h := ro.size(head.width, head.height); w != head.width || h != head.height {
+		head = cloneTree(head)
+		scaleTree(head, w, h)
 	}
-	return (re + ge + be)
+	img := imaging.New(head.width, head.height, color.Transparent)
+	return updateImage(img, leaves(head, nil), ro.shape(), ro.style(), t.background(ro, head.width, head.height), t.in, t.tileUses(img))
 }
 
-func splitHistogram(h [][]int, w int, l int, p image.Point) (*Img, *Img, *Img, *Img) {
-	c1, c2, c3, c4 := make([][]int, 0), make([][]int, 0), make([][]int, 0), make([][]int, 0)
-	p1, p2, p3, p4 := image.Point{p.X, p.Y}, image.Point{p.X + w/2, p.Y}, image.Point{p.X, p.Y + l/2}, image.Point{p.X + w/2, p.Y + l/2}
-	for i := 0; i < len(h); i++ {
-		if i < int(l/2)*w {
-			if i%w < w/2 {
-				c1 = append(c1, h[i])
-			} else {
-				c2 = append(c2, h[i])
-			}
-		} else {
-			if i%w < w/2 {
-				c3 = append(c3, h[i])
-			} else {
-				c4 = append(c4, h[i])
-			}
+// Draw redraws quads, typically the children returned by Step, onto an
+// image previously returned by Render with the same options. A Mosaic with
+// Reuse counts on from the tiles drawn on img, giving back the tile of each
+// split quad, so it can pick other tiles than Render of the same tree.
+func (t *Tree) Draw(img *image.NRGBA, ro RenderOptions, quads ...*Img) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w != t.head.width || h != t.head.height {
+		scaled := make([]*Img, len(quads))
+		for n, q := range quads {
+			c := *q
+			scaleRect(&c, t.head.width, t.head.height, w, h)
+			scaled[n] = &c
 		}
+		quads = scaled
 	}
-	return newNode(c1, w, l, p1), newNode(c2, w, l, p2), newNode(c3, w, l, p3), newNode(c4, w, l, p4)
+	updateImage(img, quads, ro.shape(), ro.style(), t.background(ro, w, h), t.in, t.tileUses(img))
 }
 
-func newNode(hist [][]int, w int, h int, p image.Point) *Img {
-	newNode := Img{
-		width:  int(w / 2),
-		height: int(h / 2),
-		hist:   hist,
-		point:  p,
+// Mosaic tile uses of img, kept for the last image rendered or drawn
+func (t *Tree) tileUses(img *image.NRGBA) *tileUses {
+	t.usesMu.Lock()
+	defer t.usesMu.Unlock()
+	if t.uses == nil || t.uses.img != img {
+		t.uses = &tileUses{img: img, count: map[*tile]int{}, quads: map[uint64]*tile{}}
 	}
-	newNode.pix = newNode.width * newNode.height
-	newNode.color, newNode.error = analyzeImage(&newNode)
-	return &newNode
+	return t.uses
 }
 
-func createImage(head *Img, border bool, circle bool, colorlist []uint8) *image.NRGBA {
-	base := color.RGBA{uint8(head.color[0]), uint8(head.color[1]), uint8(head.color[2]), uint8(head.color[3])}
-	canvas := imaging.New(head.width, head.height, base)
-	if border {
-		canvas = addBorder(canvas, head.width, head.height, head.point, colorlist)
+// Background of ro scaled to w by h, kept between calls since Draw is called
+// with every split
+func (t *Tree) background(ro RenderOptions, w int, h int) *image.NRGBA {
+	if ro.Background == nil {
+		return nil
 	}
-	if circle {
-		canvas = addCircle(canvas, head.width, head.height, head.point, colorlist)
+	t.bgMu.Lock()
+	defer t.bgMu.Unlock()
+	if t.bgSrc != ro.Background || t.bg.Bounds().Dx() != w || t.bg.Bounds().Dy() != h {
+		t.bgSrc, t.bg = ro.Background, imaging.Fill(ro.Background, w, h, imaging.Center, imaging.Lanczos)
 	}
+	return t.bg
+}
 
-	return canvas
+func analyzeImage(in *integral, m errorMetric, i *Img) ([]float64, float64) {
+	sum, _ := in.sums(i.point, i.width, i.height)
+	i.color = averageRGB(sum, i.pix)
+	return i.color, m.Error(in, i)
 }
 
-func updateImage(img *image.NRGBA, sub_imgs []*Img, border bool, circle bool, colorlist []uint8) *image.NRGBA {
-	for _, i := range sub_imgs {
-		c := []uint8{uint8(i.color[0]), uint8(i.color[1]), uint8(i.color[2]), uint8(i.color[3])}
-		new_img := pasteImage(img, i.width, i.height, i.point, c)
-		if border {
-			new_img = addBorder(new_img, i.width, i.height, i.point, colorlist)
-		}
-		if circle {
-			new_img = addCircle(new_img, i.width, i.height, i.point, colorlist)
-		}
-	}
-	return img
+func averageRGB(sum []float64, p int) []float64 {
+	pix := float64(p)
+	avg := []float64{sum[0] / pix, sum[1] / pix, sum[2] / pix, sum[3] / pix}
+	return avg
 }
 
-func pasteImage(bg *image.NRGBA, w int, h int, point image.Point, c []uint8) *image.NRGBA {
-	for i := point.Y; i < point.Y+h; i++ {
-		for j := point.X; j < point.X+w; j++ {
-			copy(bg.Pix[i*bg.Stride+j*4:i*bg.Stride+(j+1)*4], c)
-		}
-	}
-	return bg
+func calculateError(sum []float64, sq []float64, p int) float64 {
+	pix := float64(p)
+	re := sq[0] - sum[0]*sum[0]/pix
+	ge := sq[1] - sum[1]*sum[1]/pix
+	be := sq[2] - sum[2]*sum[2]/pix
+	return math.Max(re+ge+be, 0)
 }
 
-func saveImage(fo *image.NRGBA, in string, itr int, max int) error {
-	il, ml := len(strconv.Itoa(itr)), len(strconv.Itoa(max))
-	var num bytes.Buffer
-	for i := il; i < ml; i++ {
-		num.WriteString("0")
+func splitNode(in *integral, m errorMetric, a *Img) (*Img, *Img, *Img, *Img) {
+	c1, c2, c3, c4 := splitRect(a)
+	for _, c := range []*Img{c1, c2, c3, c4} {
+		c.color, c.error = analyzeImage(in, m, c)
 	}
-	num.WriteString(strconv.Itoa(itr))
-	n := concatName(in, num.String())
-	imaging.Save(fo, outputFolder+n)
-
-	return nil
+	return c1, c2, c3, c4
 }
 
-func addCircle(img *image.NRGBA, w int, h int, point image.Point, cl []uint8) *image.NRGBA {
-	for y := point.Y; y < point.Y+h; y++ {
-		for x := point.X; x < point.X+w; x++ {
-			if euclideanDistance(w/2, x-point.X, h/2, y-point.Y) >= ovalRadius(w/2, h/2, getAngle(w, h, x-point.X, y-point.Y)) {
-				copy(img.Pix[x*4+y*img.Stride:(x+1)*4+y*img.Stride], cl)
-			}
-		}
+func splitRect(a *Img) (*Img, *Img, *Img, *Img) {
+	w1, l1, p := a.width/2, a.height/2, a.point
+	w2, l2 := a.width-w1, a.height-l1
+	p1, p2, p3, p4 := image.Point{p.X, p.Y}, image.Point{p.X + w1, p.Y}, image.Point{p.X, p.Y + l1}, image.Point{p.X + w1, p.Y + l1}
+	c1, c2, c3, c4 := &Img{width: w1, height: l1, point: p1}, &Img{width: w2, height: l1, point: p2}, &Img{width: w1, height: l2, point: p3}, &Img{width: w2, height: l2, point: p4}
+	for k, c := range []*Img{c1, c2, c3, c4} {
+		c.pix = c.width * c.height
+		c.depth = a.depth + 1
+		c.id = 4*a.id + uint64(k) + 1
 	}
-	return img
+	return c1, c2, c3, c4
 }
 
-func addBorder(img *image.NRGBA, w int, h int, point image.Point, bor []uint8) *image.NRGBA {
-	for x := point.X; x < point.X+w; x++ {
-		copy(img.Pix[point.Y*img.Stride+x*4:point.Y*img.Stride+(x+1)*4], bor)
-		copy(img.Pix[(point.Y+(h-1))*img.Stride+x*4:(point.Y+(h-1))*img.Stride+(x+1)*4], bor)
+func newNode(in *integral, m errorMetric, w int, h int, p image.Point) *Img {
+	newNode := Img{
+		width:  w,
+		height: h,
+		point:  p,
 	}
-	for y := point.Y + 1; y < point.Y+h-1; y++ {
-		copy(img.Pix[y*img.Stride+point.X*4:y*img.Stride+4+point.X*4], bor)
-		copy(img.Pix[y*img.Stride+w*4-4+point.X*4:y*img.Stride+w*4+point.X*4], bor)
+	newNode.pix = newNode.width * newNode.height
+	newNode.color, newNode.error = analyzeImage(in, m, &newNode)
+	return &newNode
+}
+
+func updateImage(img *image.NRGBA, sub_imgs []*Img, shape ShapeRenderer, st Style, bg *image.NRGBA, src *integral, uses *tileUses) *image.NRGBA {
+	cv := &Canvas{Img: img, bg: bg, src: src, uses: uses}
+	for _, i := range sub_imgs {
+		if i.width <= 0 || i.height <= 0 {
+			continue
+		}
+		c := color.NRGBA{uint8(i.color[0]), uint8(i.color[1]), uint8(i.color[2]), uint8(i.color[3])}
+		cv.quad = i.id
+		shape.Draw(cv, i.Bounds(), c, st)
 	}
 	return img
 }
@@ -0,0 +1,138 @@
+package quads
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// Draws each split onto a rendered image and checks it against Render
+func testDraw(t *testing.T, name string, ro RenderOptions) {
+	tr, err := New(testImage(83, 59), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := tr.Render(ro)
+	for i := 0; i < 60; i++ {
+		a := tr.Step()
+		tr.Draw(img, ro, a.Children()...)
+	}
+	if !bytes.Equal(img.Pix, tr.Render(ro).Pix) {
+		t.Errorf("%s: drawing splits differs from Render", name)
+	}
+}
+
+func TestDrawGlyphs(t *testing.T) {
+	for _, font := range []string{"mono", "basic"} {
+		g, err := NewGlyphs(font)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testDraw(t, font+" ramp", RenderOptions{Shape: g, AntiAlias: true})
+		g.Text = "go quads"
+		testDraw(t, font+" text", RenderOptions{Shape: g, AntiAlias: true})
+		testDraw(t, font+" text scaled", RenderOptions{Shape: g, Border: true, Width: 131})
+	}
+}
+
+func TestShapeByNameGlyphs(t *testing.T) {
+	a, err := ShapeByName("glyphs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ShapeByName("glyphs")
+	a.(*Glyphs).Text = "go"
+	if a == b || b.(*Glyphs).Text != "" {
+		t.Error("ShapeByName returned shared Glyphs")
+	}
+}
+
+func TestDrawMosaic(t *testing.T) {
+	m := &Mosaic{}
+	for k := 0; k < 6; k++ {
+		m.Add(testImage(10+k, 12))
+	}
+	testDraw(t, "mosaic", RenderOptions{Shape: m})
+	m.Layout = true
+	testDraw(t, "mosaic layout", RenderOptions{Shape: m, Border: true})
+
+	//With Reuse each split gives its tile back for its children
+	m.Reuse = 40
+	tr, err := New(testImage(83, 59), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro := RenderOptions{Shape: m, Width: 131}
+	img := tr.Render(ro)
+	for i := 0; i < 60; i++ {
+		tr.Draw(img, ro, tr.Step().Children()...)
+	}
+	u, count := tr.tileUses(img), map[*tile]int{}
+	for _, l := range tr.Leaves() {
+		if u.quads[l.id] == nil {
+			t.Fatalf("no tile recorded for leaf %d", l.id)
+		}
+		count[u.quads[l.id]]++
+	}
+	if len(u.quads) != len(tr.Leaves()) {
+		t.Errorf("tiles recorded for %d quads, want the %d leaves", len(u.quads), len(tr.Leaves()))
+	}
+	for k, n := range u.count {
+		if n != count[k] {
+			t.Errorf("tile counted %d times, drawn in %d leaves", n, count[k])
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	run := func(workers int) []*Img {
+		opts := DefaultOptions()
+		opts.Iterations, opts.Batch, opts.Workers = 400, 16, workers
+		tr, err := New(testImage(211, 157), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return tr.Leaves()
+	}
+	want := run(1)
+	for _, workers := range []int{2, 8} {
+		got := run(workers)
+		if len(got) != len(want) {
+			t.Fatalf("%d workers: %d leaves, want %d", workers, len(got), len(want))
+		}
+		for i, l := range got {
+			if l.Bounds() != want[i].Bounds() || l.Color() != want[i].Color() || l.Error() != want[i].Error() {
+				t.Fatalf("%d workers: leaf %d is %v %v, want %v %v", workers, i, l.Bounds(), l.Color(), want[i].Bounds(), want[i].Color())
+			}
+		}
+	}
+}
+
+func TestBatchStop(t *testing.T) {
+	for _, opts := range []Options{{MaxLeaves: 50}, {MaxDepth: 3}, {TargetError: 2e6}, {MaxLeaves: 50, Iterations: 30, StopAll: true}} {
+		leaves := map[int]int{}
+		for _, batch := range []int{1, 16} {
+			opts.Batch, opts.Metric, opts.AreaPower, opts.DepthPenalty, opts.MinSize = batch, "mse", 1, 1, 1
+			tr, err := New(testImage(211, 157), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tr.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			leaves[batch] = tr.Stats().Leaves
+			if s := tr.Stats(); opts.MaxDepth > 0 && s.Depth != opts.MaxDepth {
+				t.Errorf("batch %d: stopped at depth %d, want %d", batch, s.Depth, opts.MaxDepth)
+			}
+		}
+		if opts.MaxLeaves > 0 && leaves[16] != leaves[1] {
+			t.Errorf("%+v: batches stopped at %d leaves, single splits at %d", opts, leaves[16], leaves[1])
+		}
+		if opts.TargetError > 0 && leaves[16] > leaves[1]+3 {
+			t.Errorf("batches split to %d leaves past the target error, single splits stopped at %d", leaves[16], leaves[1])
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// shape.go
+package quads
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/vector"
+)
+
+// ShapeRenderer draws a leaf quad covering r with color c onto a Canvas.
+type ShapeRenderer interface {
+	Draw(cv *Canvas, r image.Rectangle, c color.NRGBA, st Style)
+}
+
+// Style is the part of RenderOptions passed to a ShapeRenderer.
+type Style struct {
+	Color       color.NRGBA //Border/ background color outside the shape
+	Border      bool        //Add a 1px border to quads
+	AntiAlias   bool        //Blend shape edges by their exact pixel coverage
+	Supersample int         //Blend shape edges by n by n samples per pixel instead, when above 1
+	Radius      float64     //Corner radius of rounded rects in pixels
+}
+
+// Canvas is an image being rendered. Whatever is drawn is composited over
+// the RenderOptions background, if any.
+type Canvas struct {
+	Img   *image.NRGBA
+	bg    *image.NRGBA
+	src   *integral               //Source image statistics, nil for decoded trees
+	masks map[image.Point][]uint8 //Coverage masks of the current shape by quad size
+	uses  *tileUses               //Mosaic tiles drawn on Img
+	quad  uint64                  //Position in the tree of the quad being drawn
+}
+
+var shapes = map[string]ShapeRenderer{
+	"rect":      rectShape{},
+	"ellipse":   maskShape{path: ellipsePath, element: ellipseSVG, hard: hardEllipse},
+	"rounded":   maskShape{path: roundedPath, element: roundedSVG},
+	"diamond":   polygonShape(diamondPoints),
+	"triangles": polygonShape(trianglePoints),
+	"hexagon":   polygonShape(hexagonPoints),
+	"cross":     polygonShape(crossPoints),
+	"glyphs":    nil, //Glyphs keep settings and a mask cache, ShapeByName returns new ones
+}
+
+// Shapes lists the names accepted by ShapeByName.
+func Shapes() []string {
+	n := []string{}
+	for k := range shapes {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// ShapeByName returns a built-in ShapeRenderer. Glyphs are new for each
+// call, drawn with the mono font.
+func ShapeByName(name string) (ShapeRenderer, error) {
+	s, ok := shapes[name]
+	if !ok {
+		return nil, fmt.Errorf("Error: unknown shape %q, not one of %s", name, strings.Join(Shapes(), ", "))
+	}
+	if name == "glyphs" {
+		g, err := NewGlyphs("mono")
+		if err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+	return s, nil
+}
+
+// Fill paints r with c.
+func (cv *Canvas) Fill(r image.Rectangle, c color.NRGBA) {
+	r = r.Intersect(cv.Img.Bounds())
+	p := []uint8{c.R, c.G, c.B, c.A}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cv.paint(cv.Img.PixOffset(x, y), p)
+		}
+	}
+}
+
+// Border paints the 1px edge of r with c.
+func (cv *Canvas) Border(r image.Rectangle, c color.NRGBA) {
+	p := []uint8{c.R, c.G, c.B, c.A}
+	for x := r.Min.X; x < r.Max.X; x++ {
+		cv.paint(cv.Img.PixOffset(x, r.Min.Y), p)
+		cv.paint(cv.Img.PixOffset(x, r.Max.Y-1), p)
+	}
+	for y := r.Min.Y + 1; y < r.Max.Y-1; y++ {
+		cv.paint(cv.Img.PixOffset(r.Min.X, y), p)
+		cv.paint(cv.Img.PixOffset(r.Max.X-1, y), p)
+	}
+}
+
+// Mask keeps the part of each pixel of r covered by mask, one byte per pixel
+// in rows, and paints the rest with out.
+func (cv *Canvas) Mask(r image.Rectangle, mask []uint8, out color.NRGBA) {
+	p, in := []uint8{out.R, out.G, out.B, out.A}, make([]uint8, 4)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cov := mask[(y-r.Min.Y)*r.Dx()+x-r.Min.X]
+			if cov == 255 {
+				continue
+			}
+			o := cv.Img.PixOffset(x, y)
+			copy(in, cv.Img.Pix[o:o+4])
+			cv.paint(o, p)
+			if cov > 0 {
+				mix(cv.Img.Pix[o:o+4], in, cov)
+			}
+		}
+	}
+}
+
+// Paste paints img over r, starting at its top left pixel.
+func (cv *Canvas) Paste(r image.Rectangle, img *image.NRGBA) {
+	r = r.Intersect(cv.Img.Bounds())
+	b := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y && y-r.Min.Y < b.Dy(); y++ {
+		for x := r.Min.X; x < r.Max.X && x-r.Min.X < b.Dx(); x++ {
+			o := img.PixOffset(b.Min.X+x-r.Min.X, b.Min.Y+y-r.Min.Y)
+			cv.paint(cv.Img.PixOffset(x, y), img.Pix[o:o+4])
+		}
+	}
+}
+
+// Quarters returns the average source image colors of the top left, top
+// right, bottom left and bottom right quarters of r, or false when the tree
+// has no source image.
+func (cv *Canvas) Quarters(r image.Rectangle) ([4]color.NRGBA, bool) {
+	var qs [4]color.NRGBA
+	if cv.src == nil {
+		return qs, false
+	}
+	//r is in output pixels, which may be scaled from the source
+	w, h := cv.Img.Bounds().Dx(), cv.Img.Bounds().Dy()
+	a := &Img{point: image.Point{r.Min.X * cv.src.width / w, r.Min.Y * cv.src.height / h}}
+	a.width, a.height = r.Max.X*cv.src.width/w-a.point.X, r.Max.Y*cv.src.height/h-a.point.Y
+	c1, c2, c3, c4 := splitRect(a)
+	for k, c := range []*Img{c1, c2, c3, c4} {
+		//Quarters of a 1px wide or tall quad are empty, use the whole quad
+		if c.width == 0 || c.height == 0 {
+			c = a
+		}
+		if c.width == 0 || c.height == 0 {
+			return qs, false
+		}
+		sum, _ := cv.src.sums(c.point, c.width, c.height)
+		avg := averageRGB(sum, c.width*c.height)
+		qs[k] = color.NRGBA{uint8(avg[0]), uint8(avg[1]), uint8(avg[2]), uint8(avg[3])}
+	}
+	return qs, true
+}
+
+// Sets the pixel at offset o to c, composited over the same pixel of the
+// background when there is one
+func (cv *Canvas) paint(o int, c []uint8) {
+	p := cv.Img.Pix[o : o+4]
+	if cv.bg == nil || c[3] == 255 {
+		copy(p, c)
+		return
+	}
+	b := cv.bg.Pix[o : o+4]
+	ca, ba := int(c[3]), int(b[3])*(255-int(c[3]))/255
+	a := ca + ba
+	if a == 0 {
+		copy(p, []uint8{0, 0, 0, 0})
+		return
+	}
+	for k := 0; k < 3; k++ {
+		p[k] = uint8((int(c[k])*ca + int(b[k])*ba) / a)
+	}
+	p[3] = uint8(a)
+}
+
+// Coverage mask of a w by h quad from m, kept for other quads of that size
+func (cv *Canvas) mask(w int, h int, m func() []uint8) []uint8 {
+	k := image.Point{w, h}
+	if cv.masks == nil {
+		cv.masks = map[image.Point][]uint8{}
+	}
+	if _, ok := cv.masks[k]; !ok {
+		cv.masks[k] = m()
+	}
+	return cv.masks[k]
+}
+
+// Implemented by the built-in shapes to be written by WriteSVG, others are
+// written as rects
+type svgShape interface {
+	svg(x float64, y float64, w float64, h float64, st Style) string
+}
+
+// Implemented by shapes whose SVG element also depends on the quad's color c
+// and its position id in the tree
+type svgLeafShape interface {
+	svgLeaf(id uint64, x float64, y float64, w float64, h float64, c color.NRGBA, st Style) string
+}
+
+type rectShape struct{}
+
+func (rectShape) Draw(cv *Canvas, r image.Rectangle, c color.NRGBA, st Style) {
+	cv.Fill(r, c)
+	if st.Border {
+		cv.Border(r, st.Color)
+	}
+}
+
+func (rectShape) svg(x float64, y float64, w float64, h float64, st Style) string {
+	return fmt.Sprintf("<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\"", x, y, w, h)
+}
+
+// Shape outlined by a vector path, with the outside of the path in the
+// background color
+type maskShape struct {
+	path    func(z *vector.Rasterizer, w float32, h float32, px float32, st Style) //Outline in a w by h box with px units per pixel
+	element func(x float64, y float64, w float64, h float64, st Style) string      //SVG element without paint or closing
+	hard    maskFunc                                                               //Coverage without anti-aliasing, nil to threshold the path
+}
+
+func (s maskShape) Draw(cv *Canvas, r image.Rectangle, c color.NRGBA, st Style) {
+	cv.Fill(r, c)
+	if st.Border {
+		cv.Border(r, st.Color)
+	}
+	w, h := r.Dx(), r.Dy()
+	cv.Mask(r, cv.mask(w, h, func() []uint8 { return s.mask(w, h, st) }), st.Color)
+}
+
+func (s maskShape) svg(x float64, y float64, w float64, h float64, st Style) string {
+	return s.element(x, y, w, h, st)
+}
+
+func (s maskShape) mask(w int, h int, st Style) []uint8 {
+	switch {
+	case st.Supersample > 1:
+		return sampledMask(s.path, w, h, st.Supersample, st)
+	case st.AntiAlias:
+		return pathMask(s.path, w, h, 1, st)
+	case s.hard != nil:
+		return s.hard(w, h)
+	}
+	return sampledMask(s.path, w, h, 1, st)
+}
+
+// Shape outlined by polygons, from their corners in a w by h box
+func polygonShape(points func(w float32, h float32, px float32) [][]float32) maskShape {
+	return maskShape{
+		path: func(z *vector.Rasterizer, w float32, h float32, px float32, st Style) {
+			for _, pl := range points(w, h, px) {
+				z.MoveTo(pl[0], pl[1])
+				for i := 2; i < len(pl); i += 2 {
+					z.LineTo(pl[i], pl[i+1])
+				}
+				z.ClosePath()
+			}
+		},
+		element: func(x float64, y float64, w float64, h float64, st Style) string {
+			d := ""
+			for _, pl := range points(float32(w), float32(h), 1) {
+				for i := 0; i < len(pl); i += 2 {
+					cmd := "L"
+					if i == 0 {
+						cmd = "M"
+					}
+					d += fmt.Sprintf("%s%g,%g ", cmd, x+float64(pl[i]), y+float64(pl[i+1]))
+				}
+				d += "Z "
+			}
+			return fmt.Sprintf("<path d=\"%s\"", strings.TrimSpace(d))
+		},
+	}
+}
+
+func ellipsePath(z *vector.Rasterizer, w float32, h float32, px float32, st Style) {
+	//Control point distance approximating a quarter ellipse with a cubic
+	const k = 0.5522848
+	rx, ry := w/2, h/2
+	z.MoveTo(w, ry)
+	z.CubeTo(w, ry+k*ry, rx+k*rx, h, rx, h)
+	z.CubeTo(rx-k*rx, h, 0, ry+k*ry, 0, ry)
+	z.CubeTo(0, ry-k*ry, rx-k*rx, 0, rx, 0)
+	z.CubeTo(rx+k*rx, 0, w, ry-k*ry, w, ry)
+	z.ClosePath()
+}
+
+func ellipseSVG(x float64, y float64, w float64, h float64, st Style) string {
+	return fmt.Sprintf("<ellipse cx=\"%g\" cy=\"%g\" rx=\"%g\" ry=\"%g\"", x+w/2, y+h/2, w/2, h/2)
+}
+
+// Corner radius of a rounded rect, at most half of its shorter side
+func cornerRadius(w float32, h float32, r float32) float32 {
+	if m := minFloat32(w, h) / 2; r > m {
+		return m
+	}
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+func roundedPath(z *vector.Rasterizer, w float32, h float32, px float32, st Style) {
+	const k = 0.5522848
+	r := cornerRadius(w, h, float32(st.Radius)*px)
+	z.MoveTo(r, 0)
+	z.LineTo(w-r, 0)
+	z.CubeTo(w-r+k*r, 0, w, r-k*r, w, r)
+	z.LineTo(w, h-r)
+	z.CubeTo(w, h-r+k*r, w-r+k*r, h, w-r, h)
+	z.LineTo(r, h)
+	z.CubeTo(r-k*r, h, 0, h-r+k*r, 0, h-r)
+	z.LineTo(0, r)
+	z.CubeTo(0, r-k*r, r-k*r, 0, r, 0)
+	z.ClosePath()
+}
+
+func roundedSVG(x float64, y float64, w float64, h float64, st Style) string {
+	r := cornerRadius(float32(w), float32(h), float32(st.Radius))
+	return fmt.Sprintf("<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" rx=\"%g\"", x, y, w, h, r)
+}
+
+func diamondPoints(w float32, h float32, px float32) [][]float32 {
+	return [][]float32{{w / 2, 0, w, h / 2, w / 2, h, 0, h / 2}}
+}
+
+// Two triangles split along the quad's diagonal by a 1px gap
+func trianglePoints(w float32, h float32, px float32) [][]float32 {
+	gx, gy := minFloat32(px, w/2), minFloat32(px, h/2)
+	return [][]float32{{0, 0, w - gx, 0, 0, h - gy}, {w, gy, w, h, gx, h}}
+}
+
+func hexagonPoints(w float32, h float32, px float32) [][]float32 {
+	return [][]float32{{w / 4, 0, w * 3 / 4, 0, w, h / 2, w * 3 / 4, h, w / 4, h, 0, h / 2}}
+}
+
+// Plus sign with arms a third of the quad wide
+func crossPoints(w float32, h float32, px float32) [][]float32 {
+	x1, x2, y1, y2 := w/3, w*2/3, h/3, h*2/3
+	return [][]float32{{x1, 0, x2, 0, x2, y1, w, y1, w, y2, x2, y2, x2, h, x1, h, x1, y2, 0, y2, 0, y1, x1, y1}}
+}
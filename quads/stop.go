@@ -0,0 +1,115 @@
+// stop.go
+package quads
+
+import (
+	"math"
+	"time"
+)
+
+type stopCriteria struct {
+	itr    int           //Maximum number of iterations
+	err    float64       //Target total error
+	psnr   float64       //Target PSNR in dB
+	leaves int           //Maximum number of leaf quads
+	depth  int           //Maximum depth of a leaf quad
+	size   int           //Minimum width or height of a leaf quad
+	time   time.Duration //Wall clock budget
+	all    bool          //Stop once all criteria are met instead of any
+}
+
+type progress struct {
+	itr    int       //Iterations performed
+	err    float64   //Total error of leaf quads
+	sse    float64   //Total squared RGB error of leaf quads
+	pix    int       //Number of pixels in image
+	leaves int       //Number of leaf quads
+	depth  int       //Deepest leaf quad
+	size   int       //Smallest width or height of a leaf quad
+	start  time.Time //Start of iterations
+}
+
+func newProgress(in *integral, hn *Img) *progress {
+	pg := progress{
+		pix:   hn.pix,
+		size:  minInt(hn.width, hn.height),
+		start: time.Now(),
+	}
+	for _, l := range leaves(hn, nil) {
+		if in != nil {
+			sum, sq := in.sums(l.point, l.width, l.height)
+			pg.err += l.error
+			pg.sse += calculateError(sum, sq, l.pix)
+		}
+		pg.leaves++
+		if l.depth > pg.depth {
+			pg.depth = l.depth
+		}
+		pg.size = minInt(pg.size, minInt(l.width, l.height))
+	}
+	pg.itr = (pg.leaves - 1) / 3
+	return &pg
+}
+
+func (pg *progress) restart() {
+	pg.start = time.Now()
+}
+
+func (pg *progress) update(in *integral, a *Img) {
+	pg.itr++
+	pg.leaves += 3
+	sum, sq := in.sums(a.point, a.width, a.height)
+	pg.err -= a.error
+	pg.sse -= calculateError(sum, sq, a.pix)
+	for _, c := range []*Img{a.c1, a.c2, a.c3, a.c4} {
+		sum, sq = in.sums(c.point, c.width, c.height)
+		pg.err += c.error
+		pg.sse += calculateError(sum, sq, c.pix)
+		if c.depth > pg.depth {
+			pg.depth = c.depth
+		}
+		pg.size = minInt(pg.size, minInt(c.width, c.height))
+	}
+}
+
+func (pg *progress) psnr() float64 {
+	mse := math.Max(pg.sse, 0) / float64(pg.pix*3)
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func (st stopCriteria) done(pg *progress) bool {
+	met := []bool{}
+	if st.itr > 0 {
+		met = append(met, pg.itr >= st.itr)
+	}
+	if st.err > 0 {
+		met = append(met, pg.err <= st.err)
+	}
+	if st.psnr > 0 {
+		met = append(met, pg.psnr() >= st.psnr)
+	}
+	if st.leaves > 0 {
+		met = append(met, pg.leaves >= st.leaves)
+	}
+	if st.depth > 0 {
+		met = append(met, pg.depth >= st.depth)
+	}
+	if st.size > 0 {
+		met = append(met, pg.size <= st.size)
+	}
+	if st.time > 0 {
+		met = append(met, time.Since(pg.start) >= st.time)
+	}
+
+	if len(met) == 0 {
+		return false
+	}
+	for _, m := range met {
+		if m != st.all {
+			return !st.all
+		}
+	}
+	return st.all
+}
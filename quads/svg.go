@@ -0,0 +1,75 @@
+// svg.go
+package quads
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteSVG writes the leaf quads of the tree as SVG elements of their shape,
+// grouped by depth. Shapes other than the built-in ones are written as rects,
+// glyphs as paths of their outlines.
+func (t *Tree) WriteSVG(out io.Writer, ro RenderOptions) error {
+	head := t.head
+	border, cl, st := ro.Border, ro.colorlist(), ro.style()
+	shape, ok := ro.shape().(svgShape)
+	leafShape, leafOk := ro.shape().(svgLeafShape)
+	if !ok {
+		shape = rectShape{}
+	}
+	_, rect := shape.(rectShape)
+	rect = rect && !leafOk
+	sw, sh := ro.size(head.width, head.height)
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"%d %d %d %d\">\n",
+		sw, sh, head.point.X, head.point.Y, head.width, head.height)
+	if !rect {
+		fmt.Fprintf(w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" %s/>\n",
+			head.point.X, head.point.Y, head.width, head.height, svgPaint("fill", cl))
+	}
+
+	stroke := ""
+	if border {
+		stroke = svgPaint("stroke", cl) + " stroke-width=\"1\" "
+	}
+	depths := [][]*Img{}
+	for _, l := range leaves(head, nil) {
+		for len(depths) <= l.depth {
+			depths = append(depths, nil)
+		}
+		depths[l.depth] = append(depths[l.depth], l)
+	}
+	for d, ls := range depths {
+		if len(ls) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "<g id=\"depth-%d\">\n", d)
+		for _, l := range ls {
+			c := []uint8{uint8(l.color[0]), uint8(l.color[1]), uint8(l.color[2]), uint8(l.color[3])}
+			x, y, lw, lh := float64(l.point.X), float64(l.point.Y), float64(l.width), float64(l.height)
+			if border {
+				//Keep the stroke inside the quad like the raster border
+				x, y, lw, lh = x+0.5, y+0.5, lw-1, lh-1
+			}
+			el := ""
+			if leafOk {
+				el = leafShape.svgLeaf(l.id, x, y, lw, lh, l.Color(), st)
+			} else {
+				el = shape.svg(x, y, lw, lh, st)
+			}
+			fmt.Fprintf(w, "%s %s%s/>\n", el, stroke, svgPaint("fill", c))
+		}
+		fmt.Fprintln(w, "</g>")
+	}
+	fmt.Fprintln(w, "</svg>")
+	return w.Flush()
+}
+
+func svgPaint(attr string, c []uint8) string {
+	p := fmt.Sprintf("%s=\"#%02x%02x%02x\"", attr, c[0], c[1], c[2])
+	if c[3] != 255 {
+		p += fmt.Sprintf(" %s-opacity=\"%.3g\"", attr, float64(c[3])/255)
+	}
+	return p
+}
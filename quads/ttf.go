@@ -0,0 +1,337 @@
+// ttf.go
+package quads
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Reads glyph outlines of TrueType fonts, enough for the vendored Go fonts.
+// The vendored sfnt package needs golang.org/x/text, which is not vendored.
+type ttFont struct {
+	tables   map[string][]byte
+	longLoc  bool   //loca offsets are 32 bit
+	glyphs   int    //Number of glyphs
+	hmetrics int    //Number of advances in hmtx
+	cmap     []byte //Format 4 subtable of Unicode characters
+}
+
+// Segment of a glyph outline
+type glyphSeg struct {
+	op  byte      //'M', 'L' or 'Q'
+	pts []float32 //End point, after the control point of Q. Font units, y down
+}
+
+var errFont = errors.New("Error: malformed TrueType font")
+
+// Checks the table sizes that glyphIndex, advance and outline read within
+func parseTTF(data []byte) (*ttFont, error) {
+	f := &ttFont{tables: map[string][]byte{}}
+	if !fits(data, 0, 12) {
+		return nil, errFont
+	}
+	n := u16(data, 4)
+	if !fits(data, 12, 16*n) {
+		return nil, errFont
+	}
+	for i := 0; i < n; i++ {
+		rec := data[12+16*i:]
+		off, l := uint64(binary.BigEndian.Uint32(rec[8:])), uint64(binary.BigEndian.Uint32(rec[12:]))
+		if off+l > uint64(len(data)) {
+			return nil, errFont
+		}
+		f.tables[string(rec[:4])] = data[off : off+l]
+	}
+	head, maxp, hhea := f.tables["head"], f.tables["maxp"], f.tables["hhea"]
+	if !fits(head, 50, 2) || !fits(maxp, 4, 2) || !fits(hhea, 34, 2) {
+		return nil, errFont
+	}
+	f.longLoc = u16(head, 50) != 0
+	f.glyphs = u16(maxp, 4)
+	f.hmetrics = u16(hhea, 34)
+	locSize := 2
+	if f.longLoc {
+		locSize = 4
+	}
+	if f.hmetrics == 0 || !fits(f.tables["hmtx"], 0, 4*f.hmetrics) || !fits(f.tables["loca"], 0, locSize*(f.glyphs+1)) || f.tables["glyf"] == nil {
+		return nil, errFont
+	}
+
+	cm := f.tables["cmap"]
+	if !fits(cm, 0, 4) || !fits(cm, 4, 8*u16(cm, 2)) {
+		return nil, errFont
+	}
+	for i := 0; i < u16(cm, 2); i++ {
+		pid, eid, off := u16(cm, 4+8*i), u16(cm, 6+8*i), int(binary.BigEndian.Uint32(cm[8+8*i:]))
+		if !(pid == 0 || pid == 3 && eid == 1) || !fits(cm, off, 14) || u16(cm, off) != 4 {
+			continue
+		}
+		//End, start, delta and range offset arrays of the segments
+		f.cmap = cm[off:]
+		if !fits(f.cmap, 14, 2+8*(u16(f.cmap, 6)/2)) {
+			return nil, errFont
+		}
+		return f, nil
+	}
+	return nil, errFont
+}
+
+// Whether b holds n bytes at o
+func fits(b []byte, o int, n int) bool {
+	return o >= 0 && n >= 0 && o+n <= len(b)
+}
+
+func u16(b []byte, o int) int {
+	return int(binary.BigEndian.Uint16(b[o:]))
+}
+
+func i16(b []byte, o int) int {
+	return int(int16(binary.BigEndian.Uint16(b[o:])))
+}
+
+// Glyph of r, 0 for the missing character glyph
+func (f *ttFont) glyphIndex(r rune) (int, error) {
+	c, segs := int(r), u16(f.cmap, 6)/2
+	if c > 0xffff {
+		return 0, nil
+	}
+	for s := 0; s < segs; s++ {
+		end, start := u16(f.cmap, 14+2*s), u16(f.cmap, 16+2*segs+2*s)
+		if c > end {
+			continue
+		}
+		if c < start {
+			return 0, nil
+		}
+		delta, ro := u16(f.cmap, 16+4*segs+2*s), 16+6*segs+2*s
+		g := c
+		if u16(f.cmap, ro) != 0 {
+			//Offset from the range offset itself into the glyph id array
+			o := ro + u16(f.cmap, ro) + 2*(c-start)
+			if !fits(f.cmap, o, 2) {
+				return 0, errFont
+			}
+			if g = u16(f.cmap, o); g == 0 {
+				return 0, nil
+			}
+		}
+		if g = (g + delta) & 0xffff; g >= f.glyphs {
+			return 0, errFont
+		}
+		return g, nil
+	}
+	return 0, nil
+}
+
+// Advance width of glyph g in font units
+func (f *ttFont) advance(g int) float32 {
+	if g >= f.hmetrics {
+		g = f.hmetrics - 1
+	}
+	return float32(u16(f.tables["hmtx"], 4*g))
+}
+
+// Outline of glyph g as segments of closed contours
+func (f *ttFont) outline(g int) ([]glyphSeg, error) {
+	return f.appendOutline(nil, g, [6]float32{1, 0, 0, 1, 0, 0}, 0)
+}
+
+// Appends glyph g transformed by the matrix m = [xx, xy, yx, yy, dx, dy]
+func (f *ttFont) appendOutline(segs []glyphSeg, g int, m [6]float32, depth int) ([]glyphSeg, error) {
+	if g < 0 || g >= f.glyphs || depth > 8 {
+		return nil, errFont
+	}
+	var start, end int
+	if loca := f.tables["loca"]; f.longLoc {
+		start, end = int(binary.BigEndian.Uint32(loca[4*g:])), int(binary.BigEndian.Uint32(loca[4*g+4:]))
+	} else {
+		start, end = 2*u16(loca, 2*g), 2*u16(loca, 2*g+2)
+	}
+	if start == end {
+		return segs, nil
+	}
+	if start > end || end > len(f.tables["glyf"]) || end-start < 10 {
+		return nil, errFont
+	}
+	b := f.tables["glyf"][start:end]
+	if n := i16(b, 0); n >= 0 {
+		return appendContours(segs, b, n, m)
+	}
+
+	//Composite glyph of transformed components
+	for o := 10; ; {
+		if !fits(b, o, 4) {
+			return nil, errFont
+		}
+		flags, c := u16(b, o), u16(b, o+2)
+		o += 4
+		//Sizes of the offsets and of the scale or matrix
+		n := 2
+		if flags&1 != 0 {
+			n = 4
+		}
+		switch {
+		case flags&0x08 != 0:
+			n += 2
+		case flags&0x40 != 0:
+			n += 4
+		case flags&0x80 != 0:
+			n += 8
+		}
+		if !fits(b, o, n) {
+			return nil, errFont
+		}
+		var dx, dy float32
+		if flags&1 != 0 {
+			dx, dy = float32(i16(b, o)), float32(i16(b, o+2))
+			o += 4
+		} else {
+			dx, dy = float32(int8(b[o])), float32(int8(b[o+1]))
+			o += 2
+		}
+		cm := [6]float32{1, 0, 0, 1, dx, dy}
+		f2dot14 := func(o int) float32 { return float32(i16(b, o)) / 16384 }
+		switch {
+		case flags&0x08 != 0:
+			cm[0], cm[3] = f2dot14(o), f2dot14(o)
+			o += 2
+		case flags&0x40 != 0:
+			cm[0], cm[3] = f2dot14(o), f2dot14(o+2)
+			o += 4
+		case flags&0x80 != 0:
+			cm[0], cm[1], cm[2], cm[3] = f2dot14(o), f2dot14(o+2), f2dot14(o+4), f2dot14(o+6)
+			o += 8
+		}
+		//Point matching offsets are not supported, the component is not moved
+		if flags&0x02 == 0 {
+			cm[4], cm[5] = 0, 0
+		}
+		var err error
+		segs, err = f.appendOutline(segs, c, [6]float32{
+			m[0]*cm[0] + m[2]*cm[1], m[1]*cm[0] + m[3]*cm[1],
+			m[0]*cm[2] + m[2]*cm[3], m[1]*cm[2] + m[3]*cm[3],
+			m[0]*cm[4] + m[2]*cm[5] + m[4], m[1]*cm[4] + m[3]*cm[5] + m[5],
+		}, depth+1)
+		if err != nil || flags&0x20 == 0 {
+			return segs, err
+		}
+	}
+}
+
+// Appends the n contours of a simple glyph, turning its quadratic splines
+// with implied on-curve points into segments
+func appendContours(segs []glyphSeg, b []byte, n int, m [6]float32) ([]glyphSeg, error) {
+	if n == 0 {
+		return segs, nil
+	}
+	if !fits(b, 10, 2*n+2) {
+		return nil, errFont
+	}
+	ends := make([]int, n)
+	for i := range ends {
+		ends[i] = u16(b, 10+2*i)
+		if i > 0 && ends[i] <= ends[i-1] {
+			return nil, errFont
+		}
+	}
+	pts := ends[n-1] + 1
+	o := 10 + 2*n
+	o += 2 + u16(b, o)
+
+	flags := make([]byte, 0, pts)
+	for len(flags) < pts {
+		if !fits(b, o, 1) {
+			return nil, errFont
+		}
+		fl := b[o]
+		o++
+		flags = append(flags, fl)
+		if fl&0x08 != 0 {
+			if !fits(b, o, 1) {
+				return nil, errFont
+			}
+			for r := b[o]; r > 0; r-- {
+				flags = append(flags, fl)
+			}
+			o++
+		}
+	}
+	coords := func(short byte, same byte) ([]int, error) {
+		v, cs := 0, make([]int, pts)
+		for i, fl := range flags[:pts] {
+			switch {
+			case fl&short != 0 && fits(b, o, 1):
+				if fl&same != 0 {
+					v += int(b[o])
+				} else {
+					v -= int(b[o])
+				}
+				o++
+			case fl&short == 0 && fl&same == 0 && fits(b, o, 2):
+				v += i16(b, o)
+				o += 2
+			case fl&short != 0 || fl&same == 0:
+				return nil, errFont
+			}
+			cs[i] = v
+		}
+		return cs, nil
+	}
+	xs, err := coords(0x02, 0x10)
+	if err != nil {
+		return nil, err
+	}
+	ys, err := coords(0x04, 0x20)
+	if err != nil {
+		return nil, err
+	}
+
+	//Font y is up, outlines are y down like images
+	at := func(i int) (float32, float32) {
+		x, y := float32(xs[i]), float32(ys[i])
+		return m[0]*x + m[2]*y + m[4], -(m[1]*x + m[3]*y + m[5])
+	}
+	first := 0
+	for _, end := range ends {
+		cnt := end - first + 1
+		on := func(k int) bool { return flags[first+(k%cnt)]&0x01 != 0 }
+		pt := func(k int) (float32, float32) { return at(first + k%cnt) }
+		mid := func(k int) (float32, float32) {
+			x0, y0 := pt(k)
+			x1, y1 := pt(k + 1)
+			return (x0 + x1) / 2, (y0 + y1) / 2
+		}
+		//Start on an on-curve point, or between two control points
+		s := 0
+		for s < cnt && !on(s) {
+			s++
+		}
+		var sx, sy float32
+		if s == cnt {
+			s = 0
+			sx, sy = mid(0)
+		} else {
+			sx, sy = pt(s)
+		}
+		segs = append(segs, glyphSeg{'M', []float32{sx, sy}})
+		for k := s + 1; k <= s+cnt; k++ {
+			x, y := pt(k)
+			if on(k) {
+				segs = append(segs, glyphSeg{'L', []float32{x, y}})
+				continue
+			}
+			ex, ey := sx, sy
+			if k < s+cnt {
+				if on(k + 1) {
+					ex, ey = pt(k + 1)
+					k++
+				} else {
+					ex, ey = mid(k)
+				}
+			}
+			segs = append(segs, glyphSeg{'Q', []float32{x, y, ex, ey}})
+		}
+		first = end + 1
+	}
+	return segs, nil
+}
@@ -0,0 +1,122 @@
+package quads
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var testFonts = map[string]struct {
+	ttf  []byte
+	mono bool
+}{
+	"gomono":     {gomono.TTF, true},
+	"gomonobold": {gomonobold.TTF, true},
+	"goregular":  {goregular.TTF, false},
+}
+
+func TestTTF(t *testing.T) {
+	for name, tf := range testFonts {
+		f, err := parseTTF(tf.ttf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		seen := map[int]rune{}
+		var monoAdv float32
+		for r := rune(0x21); r < 0x7f; r++ {
+			g, err := f.glyphIndex(r)
+			if err != nil || g == 0 {
+				t.Fatalf("%s: glyph of %q is %d, %v", name, r, g, err)
+			}
+			if o, ok := seen[g]; ok {
+				t.Errorf("%s: %q and %q share glyph %d", name, o, r, g)
+			}
+			seen[g] = r
+
+			adv := f.advance(g)
+			if adv <= 0 {
+				t.Errorf("%s: advance of %q is %v", name, r, adv)
+			}
+			if monoAdv == 0 {
+				monoAdv = adv
+			}
+			if tf.mono && adv != monoAdv {
+				t.Errorf("%s: advance of %q is %v, not %v like the others", name, r, adv, monoAdv)
+			}
+
+			segs, err := f.outline(g)
+			if err != nil || len(segs) == 0 {
+				t.Fatalf("%s: outline of %q has %d segments, %v", name, r, len(segs), err)
+			}
+			if segs[0].op != 'M' {
+				t.Errorf("%s: outline of %q starts with %c", name, r, segs[0].op)
+			}
+			//The points of a simple glyph span its bounding box, y up in the font
+			start, end := glyphRange(f, g)
+			b := f.tables["glyf"][start:end]
+			if i16(b, 0) < 0 {
+				continue
+			}
+			x0, y0, x1, y1 := float32(i16(b, 2)), float32(i16(b, 4)), float32(i16(b, 6)), float32(i16(b, 8))
+			mx0, my0, mx1, my1 := segs[0].pts[0], -segs[0].pts[1], segs[0].pts[0], -segs[0].pts[1]
+			for _, s := range segs {
+				for i := 0; i < len(s.pts); i += 2 {
+					x, y := s.pts[i], -s.pts[i+1]
+					mx0, mx1 = min(mx0, x), max(mx1, x)
+					my0, my1 = min(my0, y), max(my1, y)
+				}
+			}
+			if mx0 != x0 || my0 != y0 || mx1 != x1 || my1 != y1 {
+				t.Errorf("%s: outline of %q spans %v,%v to %v,%v, box is %v,%v to %v,%v", name, r, mx0, my0, mx1, my1, x0, y0, x1, y1)
+			}
+		}
+	}
+}
+
+// Truncated fonts are errors, not panics
+func TestTTFTruncated(t *testing.T) {
+	data := goregular.TTF
+	for _, n := range []int{0, 11, 12, 100, 1000, len(data) / 2, len(data) - 1} {
+		f, err := parseTTF(data[:n])
+		if err != nil {
+			continue
+		}
+		for r := rune(0x21); r < 0x7f; r++ {
+			if g, err := f.glyphIndex(r); err == nil {
+				f.outline(g)
+			}
+		}
+	}
+
+	//Glyph data cut short inside the font either fails or only lost padding
+	f, err := parseTTF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range "g&@" {
+		g, _ := f.glyphIndex(r)
+		want, _ := f.outline(g)
+		glyf := f.tables["glyf"]
+		start, end := glyphRange(f, g)
+		for n := start; n < end; n++ {
+			f.tables["glyf"] = glyf[:n]
+			if segs, err := f.outline(g); err == nil && !reflect.DeepEqual(segs, want) {
+				t.Errorf("%q cut to %d of %d bytes gave a different outline", r, n-start, end-start)
+			}
+		}
+		f.tables["glyf"] = glyf
+	}
+}
+
+// Range of glyph g in the glyf table
+func glyphRange(f *ttFont, g int) (int, int) {
+	loca := f.tables["loca"]
+	if f.longLoc {
+		return int(binary.BigEndian.Uint32(loca[4*g:])), int(binary.BigEndian.Uint32(loca[4*g+4:]))
+	}
+	return 2 * u16(loca, 2*g), 2 * u16(loca, 2*g+2)
+}
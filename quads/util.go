@@ -1,46 +1,13 @@
 // util.go
-package main
+package quads
 
 import (
-	"fmt"
 	"image"
-	"image/color/palette"
-	"image/draw"
-	"image/gif"
-	"io"
 	"math"
-	"os"
-	"strconv"
-	"strings"
 
 	"github.com/disintegration/imaging"
 )
 
-func openImage(filename string) (*image.NRGBA, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	img, err := decodeImage(f)
-	if err != nil {
-		return nil, err
-	}
-	return cropImage(img), err
-}
-
-func decodeImage(i io.Reader) (*image.NRGBA, error) {
-	img, _, err := image.Decode(i)
-	if err != nil {
-		return nil, err
-	}
-	nrgba, err := toNRGBA(img)
-	if err != nil {
-		return nil, err
-	}
-	return nrgba, nil
-}
-
 func cropImage(img *image.NRGBA) *image.NRGBA {
 	mid_x, mid_y := int(img.Bounds().Max.X/2), int(img.Bounds().Max.Y/2)
 	new_x, new_y := resizeBounds(img)
@@ -72,62 +39,52 @@ func nearestSquare(n int) int {
 	return i / 2
 }
 
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func minFloat32(a float32, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func euclideanDistance(x1 int, x2 int, y1 int, y2 int) float64 {
 	return math.Sqrt(math.Pow(float64(x1-x2), 2) + math.Pow(float64(y1-y2), 2))
 }
 
 func getAngle(w int, h int, x int, y int) float64 {
 	dx, dy := math.Abs(float64(x-w/2)), math.Abs(float64(y-h/2))
-	return math.Atan(dy / dx)
+	return math.Atan2(dy, dx)
 }
 
 func ovalRadius(a int, b int, theta float64) float64 {
 	return float64(a*b) / math.Sqrt(math.Pow(float64(a), 2)*math.Pow(math.Sin(theta), 2)+math.Pow(float64(b), 2)*math.Pow(math.Cos(theta), 2))
 }
 
-func decodeColor(bc string) ([]uint8, error) {
-	l := strings.Split(bc, ",")
-	if len(l) < 3 || len(l) > 4 {
-		return nil, fmt.Errorf("Error: backgroundcolor length %d not 3 or 4", len(l))
-	}
-	cl := make([]uint8, 4)
-	for i := 0; i < len(l); i++ {
-		s, err := strconv.ParseUint(l[i], 10, 64)
-		if err != nil || s < 0 || s > 255 {
-			return nil, err
+// Converts 8-bit sRGB to CIELAB with a D65 white point
+func toLab(r float64, g float64, b float64) (float64, float64, float64) {
+	lin := func(c float64) float64 {
+		c /= 255
+		if c <= 0.04045 {
+			return c / 12.92
 		}
-		cl[i] = uint8(s)
-	}
-	if len(l) == 3 {
-		cl[3] = 255
-	}
-	return cl, nil
-}
-
-func concatName(name string, itr string) string {
-	n, end := splitName(name)
-	return itr + n + "." + end
-}
-
-func splitName(name string) (string, string) {
-	splt := strings.Split(name, ".")
-	return strings.Join(splt[:len(splt)-1], "."), splt[len(splt)-1]
-}
-
-//Referenced https://github.com/esimov/stackblur-go/blob/master/cmd/main.go
-func toGIF(imgs []image.Image, name string, delay int, pause int) error {
-	outGif := &gif.GIF{}
-	for _, i := range imgs {
-		inGif := image.NewPaletted(i.Bounds(), palette.Plan9)
-		draw.Draw(inGif, i.Bounds(), i, image.Point{}, draw.Src)
-		outGif.Image = append(outGif.Image, inGif)
-		outGif.Delay = append(outGif.Delay, delay)
+		return math.Pow((c+0.055)/1.055, 2.4)
 	}
-	n, _ := splitName(name)
-	f, err := os.OpenFile(outputFolder+n+".gif", os.O_WRONLY|os.O_CREATE, 0600)
-	if err != nil {
-		return err
+	f := func(t float64) float64 {
+		if t > 216.0/24389.0 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27.0*t + 16) / 116
 	}
-	defer f.Close()
-	return gif.EncodeAll(f, outGif)
+	lr, lg, lb := lin(r), lin(g), lin(b)
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / 0.95047
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / 1.08883
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
 }